@@ -0,0 +1,21 @@
+// Command packer-schema prints the JSON Schema for pack.yaml (including the
+// configuration of all the plugins).
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/EricHripko/pack.yaml/pkg/packer2llb/config"
+	_ "github.com/EricHripko/pack.yaml/pkg/plugins/golang"
+)
+
+func main() {
+	data, err := json.MarshalIndent(config.NewSchema(), "", "  ")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fmt.Println(string(data))
+}
@@ -6,17 +6,21 @@ import (
 	"fmt"
 
 	"github.com/EricHripko/pack.yaml/pkg/packer2llb"
-	"github.com/EricHripko/pack.yaml/pkg/packer2llb/config"
 
 	"github.com/EricHripko/buildkit-fdk/pkg/cib"
 	"github.com/containerd/containerd/platforms"
+	"github.com/moby/buildkit/client/llb"
 	"github.com/moby/buildkit/exporter/containerimage/exptypes"
+	"github.com/moby/buildkit/frontend/dockerfile/dockerfile2llb"
 	"github.com/moby/buildkit/frontend/gateway/client"
 	specs "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/pkg/errors"
 	"golang.org/x/sync/errgroup"
 )
 
+// Returned when none of the plugins is compatible with the project.
+var errNoPlugin = errors.New("frontend: no plugin is compatible with the project")
+
 // Build the image with this frontend.
 func Build(ctx context.Context, c client.Client) (*client.Result, error) {
 	return BuildWithService(ctx, c, cib.NewService(ctx, c))
@@ -39,30 +43,50 @@ func BuildWithService(ctx context.Context, c client.Client, svc cib.Service) (*c
 		Platforms: make([]exptypes.Platform, len(targetPlatforms)),
 	}
 
+	// Fetch config
+	dtMetadata, err := svc.GetMetadata()
+	if err != nil {
+		return nil, err
+	}
+	metadata, err := readConfig(ctx, svc, dtMetadata)
+	if err != nil {
+		return nil, withSource(ctx, c, svc, dtMetadata, err)
+	}
+
+	// Detect project type
+	plugin, detection, err := packer2llb.Detect(ctx, svc, metadata)
+	if err != nil {
+		return nil, withSource(ctx, c, svc, dtMetadata, err)
+	}
+	if plugin == nil {
+		return nil, errNoPlugin
+	}
+	target := svc.GetOpts()[keyTarget]
+	tester, canTest := plugin.(packer2llb.Tester)
+	if target == targetTest && !canTest {
+		return nil, errors.Errorf("frontend: plugin %s cannot run tests", detection.Plugin)
+	}
+
 	// Build an image for each platform
 	res := client.NewResult()
 	eg, ctx := errgroup.WithContext(ctx)
 	for i, tp := range targetPlatforms {
 		func(i int, tp *specs.Platform) {
 			eg.Go(func() error {
-				// Fetch config
-				dtMetadata, err := svc.GetMetadata()
-				if err != nil {
-					return err
-				}
-				metadata, err := config.Read(dtMetadata)
-				if err != nil {
-					return err
-				}
-
-				// Detect project type
-				plugin, err := packer2llb.Detect(ctx, svc, metadata)
-				if err != nil {
-					return err
-				}
-
 				// LLB
-				st, img, err := plugin.Build(ctx, tp, svc)
+				var (
+					st  *llb.State
+					img *dockerfile2llb.Image
+					err error
+				)
+				switch target {
+				case targetArtifacts:
+					st, err = plugin.BuildArtifacts(ctx, tp, svc, detection)
+				case targetTest:
+					st, err = tester.Test(ctx, tp, svc, detection)
+				default:
+					st, img, err = plugin.Build(ctx, tp, svc, detection)
+				}
 				if err != nil {
 					return errors.Wrapf(err, "failed to create LLB definition")
 				}
@@ -85,29 +109,19 @@ func BuildWithService(ctx context.Context, c client.Client, svc cib.Service) (*c
 				}
 
 				// Image config
-				img.Config.User = metadata.User
-				if len(metadata.Entrypoint) > 0 || len(metadata.Command) > 0 {
-					// Pre-defined command
-					img.Config.Entrypoint = metadata.Entrypoint
-					img.Config.Cmd = metadata.Command
-				} else {
-					// Find command
-					var cmd string
-					cmd, err = findCommand(ctx, ref)
+				var config []byte
+				if img != nil {
+					config, err = imageConfig(ctx, img, ref, metadata, detection)
 					if err != nil {
 						return err
 					}
-					img.Config.Entrypoint = []string{}
-					img.Config.Cmd = []string{cmd}
 				}
 
 				// Export
-				config, err := json.Marshal(img)
-				if err != nil {
-					return errors.Wrapf(err, "failed to marshal image config")
-				}
 				if !exportMap {
-					res.AddMeta(exptypes.ExporterImageConfigKey, config)
+					if config != nil {
+						res.AddMeta(exptypes.ExporterImageConfigKey, config)
+					}
 					res.SetRef(ref)
 				} else {
 					p := platforms.DefaultSpec()
@@ -116,7 +130,9 @@ func BuildWithService(ctx context.Context, c client.Client, svc cib.Service) (*c
 					}
 
 					k := platforms.Format(p)
-					res.AddMeta(fmt.Sprintf("%s/%s", exptypes.ExporterImageConfigKey, k), config)
+					if config != nil {
+						res.AddMeta(fmt.Sprintf("%s/%s", exptypes.ExporterImageConfigKey, k), config)
+					}
 					res.AddRef(k, ref)
 					expPlatforms.Platforms[i] = exptypes.Platform{
 						ID:       k,
@@ -9,11 +9,14 @@ import (
 	"github.com/EricHripko/pack.yaml/pkg/packer2llb"
 	packer2llb_mock "github.com/EricHripko/pack.yaml/pkg/packer2llb/mock"
 
+	"github.com/EricHripko/buildkit-fdk/pkg/cib"
 	cib_mock "github.com/EricHripko/buildkit-fdk/pkg/cib/mock"
 	"github.com/golang/mock/gomock"
 	"github.com/moby/buildkit/client/llb"
+	"github.com/moby/buildkit/exporter/containerimage/exptypes"
 	"github.com/moby/buildkit/frontend/dockerfile/dockerfile2llb"
 	"github.com/moby/buildkit/frontend/gateway/client"
+	"github.com/moby/buildkit/solver/errdefs"
 	specs "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
@@ -43,6 +46,18 @@ func (suite *singleTestSuite) SetupTest() {
 	suite.build.EXPECT().
 		GetIsMultiPlatform().
 		Return(false, nil)
+	suite.build.EXPECT().
+		GetBuildArgs().
+		Return(map[string]string{}).
+		AnyTimes()
+	suite.build.EXPECT().
+		GetOpts().
+		Return(map[string]string{}).
+		AnyTimes()
+	suite.build.EXPECT().
+		GetMetadataFileName().
+		Return("pack.yaml").
+		AnyTimes()
 }
 
 func (suite *singleTestSuite) TearDownTest() {
@@ -70,12 +85,42 @@ func (suite *singleTestSuite) TestReadMetadataFails() {
 	suite.build.EXPECT().
 		GetMetadata().
 		Return(data, nil)
+	suite.client.EXPECT().
+		BuildOpts().
+		Return(client.BuildOpts{})
+
+	// Act
+	_, err := BuildWithService(suite.ctx, suite.client, suite.build)
+
+	// Assert
+	require.NotNil(suite.T(), err)
+}
+
+func (suite *singleTestSuite) TestReadMetadataStrictFails() {
+	// Arrange
+	data := []byte(`
+entrypoint: ["entrypoint"]
+usr: somebody
+`)
+	suite.build.EXPECT().
+		GetMetadata().
+		Return(data, nil)
+	suite.client.EXPECT().
+		BuildOpts().
+		Return(client.BuildOpts{})
 
 	// Act
 	_, err := BuildWithService(suite.ctx, suite.client, suite.build)
 
 	// Assert
 	require.NotNil(suite.T(), err)
+	require.Contains(suite.T(), err.Error(), "pack.yaml:3:1: usr: unknown key")
+	sources := errdefs.Sources(err)
+	require.Len(suite.T(), sources, 1)
+	require.Equal(suite.T(), "pack.yaml", sources[0].Info.Filename)
+	require.Equal(suite.T(), data, sources[0].Info.Data)
+	require.Len(suite.T(), sources[0].Ranges, 1)
+	require.EqualValues(suite.T(), 3, sources[0].Ranges[0].Start.Line)
 }
 
 func (suite *singleTestSuite) TestDetectFails() {
@@ -84,7 +129,7 @@ func (suite *singleTestSuite) TestDetectFails() {
 	plugin := packer2llb_mock.NewMockPlugin(suite.ctrl)
 	plugin.EXPECT().
 		Detect(gomock.Any(), gomock.Any(), gomock.Any()).
-		Return(expected)
+		Return(nil, expected)
 	packer2llb.Register(plugin)
 
 	suite.build.EXPECT().
@@ -102,14 +147,37 @@ func (suite *singleTestSuite) TestDetectFails() {
 	require.Same(suite.T(), expected, actual)
 }
 
+func (suite *singleTestSuite) TestDetectNotFound() {
+	// Arrange
+	plugin := packer2llb_mock.NewMockPlugin(suite.ctrl)
+	plugin.EXPECT().
+		Detect(gomock.Any(), gomock.Any(), gomock.Any()).
+		Return(nil, nil)
+	packer2llb.Register(plugin)
+
+	suite.build.EXPECT().
+		GetMetadata().
+		Return([]byte(""), nil)
+	ref := cib_mock.NewMockReference(suite.ctrl)
+	suite.build.EXPECT().
+		Src().
+		Return(ref, nil)
+
+	// Act
+	_, err := BuildWithService(suite.ctx, suite.client, suite.build)
+
+	// Assert
+	require.Same(suite.T(), errNoPlugin, err)
+}
+
 func (suite *singleTestSuite) TestBuildFails() {
 	// Arrange
 	plugin := packer2llb_mock.NewMockPlugin(suite.ctrl)
 	plugin.EXPECT().
 		Detect(gomock.Any(), gomock.Any(), gomock.Any()).
-		Return(packer2llb.ErrActivate)
+		Return(&packer2llb.Detection{}, nil)
 	plugin.EXPECT().
-		Build(gomock.Any(), gomock.Any(), gomock.Any()).
+		Build(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
 		Return(nil, nil, errors.New("something went wrong"))
 	packer2llb.Register(plugin)
 
@@ -134,10 +202,10 @@ func (suite *singleTestSuite) TestSolveFails() {
 	plugin := packer2llb_mock.NewMockPlugin(suite.ctrl)
 	plugin.EXPECT().
 		Detect(gomock.Any(), gomock.Any(), gomock.Any()).
-		Return(packer2llb.ErrActivate)
+		Return(&packer2llb.Detection{}, nil)
 	state := llb.Scratch()
 	plugin.EXPECT().
-		Build(gomock.Any(), gomock.Any(), gomock.Any()).
+		Build(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
 		Return(&state, nil, nil)
 	packer2llb.Register(plugin)
 
@@ -166,10 +234,10 @@ func (suite *singleTestSuite) TestRefFails() {
 	plugin := packer2llb_mock.NewMockPlugin(suite.ctrl)
 	plugin.EXPECT().
 		Detect(gomock.Any(), gomock.Any(), gomock.Any()).
-		Return(packer2llb.ErrActivate)
+		Return(&packer2llb.Detection{}, nil)
 	state := llb.Scratch()
 	plugin.EXPECT().
-		Build(gomock.Any(), gomock.Any(), gomock.Any()).
+		Build(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
 		Return(&state, nil, nil)
 	packer2llb.Register(plugin)
 
@@ -199,11 +267,11 @@ func (suite *singleTestSuite) TestFindCommandFails() {
 	plugin := packer2llb_mock.NewMockPlugin(suite.ctrl)
 	plugin.EXPECT().
 		Detect(gomock.Any(), gomock.Any(), gomock.Any()).
-		Return(packer2llb.ErrActivate)
+		Return(&packer2llb.Detection{}, nil)
 	state := llb.Scratch()
 	img := &dockerfile2llb.Image{}
 	plugin.EXPECT().
-		Build(gomock.Any(), gomock.Any(), gomock.Any()).
+		Build(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
 		Return(&state, img, nil)
 	packer2llb.Register(plugin)
 
@@ -216,9 +284,10 @@ func (suite *singleTestSuite) TestFindCommandFails() {
 		Return(src, nil)
 
 	ref := cib_mock.NewMockReference(suite.ctrl)
+	expected := errors.New("something went wrong")
 	ref.EXPECT().
 		ReadDir(gomock.Any(), gomock.Any()).
-		Return(nil, errors.New("something went wrong"))
+		Return(nil, expected)
 
 	res := client.NewResult()
 	res.SetRef(ref)
@@ -230,7 +299,7 @@ func (suite *singleTestSuite) TestFindCommandFails() {
 	_, err := BuildWithService(suite.ctx, suite.client, suite.build)
 
 	// Assert
-	require.Same(suite.T(), errNoCommand, err)
+	require.Same(suite.T(), expected, err)
 }
 
 func (suite *singleTestSuite) TestSucceedsImplicitCommand() {
@@ -238,11 +307,11 @@ func (suite *singleTestSuite) TestSucceedsImplicitCommand() {
 	plugin := packer2llb_mock.NewMockPlugin(suite.ctrl)
 	plugin.EXPECT().
 		Detect(gomock.Any(), gomock.Any(), gomock.Any()).
-		Return(packer2llb.ErrActivate)
+		Return(&packer2llb.Detection{}, nil)
 	state := llb.Scratch()
 	img := &dockerfile2llb.Image{}
 	plugin.EXPECT().
-		Build(gomock.Any(), gomock.Any(), gomock.Any()).
+		Build(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
 		Return(&state, img, nil)
 	packer2llb.Register(plugin)
 
@@ -281,11 +350,11 @@ func (suite *singleTestSuite) TestSucceedsExplicitCommand() {
 	plugin := packer2llb_mock.NewMockPlugin(suite.ctrl)
 	plugin.EXPECT().
 		Detect(gomock.Any(), gomock.Any(), gomock.Any()).
-		Return(packer2llb.ErrActivate)
+		Return(&packer2llb.Detection{}, nil)
 	state := llb.Scratch()
 	img := &dockerfile2llb.Image{}
 	plugin.EXPECT().
-		Build(gomock.Any(), gomock.Any(), gomock.Any()).
+		Build(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
 		Return(&state, img, nil)
 	packer2llb.Register(plugin)
 
@@ -364,17 +433,32 @@ func (suite *multiTestSuite) TestSucceeds() {
 	suite.build.EXPECT().
 		GetTargetPlatforms().
 		Return(platforms, nil)
+	suite.build.EXPECT().
+		GetBuildArgs().
+		Return(map[string]string{}).
+		AnyTimes()
+	suite.build.EXPECT().
+		GetOpts().
+		Return(map[string]string{}).
+		AnyTimes()
+	suite.build.EXPECT().
+		GetMetadataFileName().
+		Return("pack.yaml").
+		AnyTimes()
 
+	// Configuration is read and the project is detected only once
 	plugin := packer2llb_mock.NewMockPlugin(suite.ctrl)
+	detection := &packer2llb.Detection{}
 	plugin.EXPECT().
 		Detect(gomock.Any(), gomock.Any(), gomock.Any()).
-		Return(packer2llb.ErrActivate).
-		Times(2)
+		Return(detection, nil)
 	state := llb.Scratch()
-	img := &dockerfile2llb.Image{}
 	plugin.EXPECT().
-		Build(gomock.Any(), gomock.Any(), gomock.Any()).
-		Return(&state, img, nil).
+		Build(gomock.Any(), gomock.Any(), gomock.Any(), detection).
+		DoAndReturn(func(context.Context, *specs.Platform, cib.Service, *packer2llb.Detection) (*llb.State, *dockerfile2llb.Image, error) {
+			// Platforms are built in parallel and must not share the image
+			return &state, &dockerfile2llb.Image{}, nil
+		}).
 		Times(2)
 	packer2llb.Register(plugin)
 
@@ -383,13 +467,11 @@ entrypoint: ["entrypoint"]
 `)
 	suite.build.EXPECT().
 		GetMetadata().
-		Return(metadata, nil).
-		Times(2)
+		Return(metadata, nil)
 	src := cib_mock.NewMockReference(suite.ctrl)
 	suite.build.EXPECT().
 		Src().
-		Return(src, nil).
-		Times(2)
+		Return(src, nil)
 
 	res := client.NewResult()
 	res.SetRef(cib_mock.NewMockReference(suite.ctrl))
@@ -407,6 +489,151 @@ entrypoint: ["entrypoint"]
 	require.Len(suite.T(), res.Refs, 2)
 }
 
+func (suite *multiTestSuite) TestSucceedsArtifacts() {
+	// Arrange
+	suite.build.EXPECT().
+		GetIsMultiPlatform().
+		Return(true, nil)
+	platforms := []*specs.Platform{
+		{OS: "linux", Architecture: "amd64"},
+		{OS: "linux", Architecture: "arm64"},
+	}
+	suite.build.EXPECT().
+		GetTargetPlatforms().
+		Return(platforms, nil)
+	suite.build.EXPECT().
+		GetBuildArgs().
+		Return(map[string]string{}).
+		AnyTimes()
+	suite.build.EXPECT().
+		GetOpts().
+		Return(map[string]string{keyTarget: targetArtifacts}).
+		AnyTimes()
+	suite.build.EXPECT().
+		GetMetadataFileName().
+		Return("pack.yaml").
+		AnyTimes()
+
+	plugin := packer2llb_mock.NewMockPlugin(suite.ctrl)
+	plugin.EXPECT().
+		Detect(gomock.Any(), gomock.Any(), gomock.Any()).
+		Return(&packer2llb.Detection{}, nil)
+	state := llb.Scratch()
+	plugin.EXPECT().
+		BuildArtifacts(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+		Return(&state, nil).
+		Times(2)
+	packer2llb.Register(plugin)
+
+	suite.build.EXPECT().
+		GetMetadata().
+		Return([]byte(""), nil)
+	src := cib_mock.NewMockReference(suite.ctrl)
+	suite.build.EXPECT().
+		Src().
+		Return(src, nil)
+
+	res := client.NewResult()
+	res.SetRef(cib_mock.NewMockReference(suite.ctrl))
+	suite.client.EXPECT().
+		Solve(gomock.Any(), gomock.Any()).
+		Return(res, nil).
+		Times(2)
+
+	// Act
+	res, err := BuildWithService(suite.ctx, suite.client, suite.build)
+
+	// Assert
+	require.Nil(suite.T(), err)
+	require.Len(suite.T(), res.Refs, 2)
+	require.Contains(suite.T(), res.Metadata, exptypes.ExporterPlatformsKey)
+	for key := range res.Metadata {
+		require.NotContains(suite.T(), key, exptypes.ExporterImageConfigKey)
+	}
+}
+
+type testerPlugin struct {
+	*packer2llb_mock.MockPlugin
+	state *llb.State
+}
+
+func (p testerPlugin) Test(context.Context, *specs.Platform, cib.Service, *packer2llb.Detection) (*llb.State, error) {
+	return p.state, nil
+}
+
+// Sets up a single-platform build for the test target.
+func (suite *multiTestSuite) setupTestTarget() {
+	suite.build.EXPECT().
+		GetIsMultiPlatform().
+		Return(false, nil)
+	platforms := []*specs.Platform{
+		{OS: "linux", Architecture: "amd64"},
+	}
+	suite.build.EXPECT().
+		GetTargetPlatforms().
+		Return(platforms, nil)
+	suite.build.EXPECT().
+		GetBuildArgs().
+		Return(map[string]string{}).
+		AnyTimes()
+	suite.build.EXPECT().
+		GetOpts().
+		Return(map[string]string{keyTarget: targetTest}).
+		AnyTimes()
+	suite.build.EXPECT().
+		GetMetadataFileName().
+		Return("pack.yaml").
+		AnyTimes()
+	suite.build.EXPECT().
+		GetMetadata().
+		Return([]byte(""), nil)
+	suite.build.EXPECT().
+		Src().
+		Return(cib_mock.NewMockReference(suite.ctrl), nil)
+}
+
+func (suite *multiTestSuite) TestTestUnsupported() {
+	// Arrange
+	suite.setupTestTarget()
+	plugin := packer2llb_mock.NewMockPlugin(suite.ctrl)
+	plugin.EXPECT().
+		Detect(gomock.Any(), gomock.Any(), gomock.Any()).
+		Return(&packer2llb.Detection{Plugin: "mock"}, nil)
+	packer2llb.Register(plugin)
+
+	// Act
+	_, err := BuildWithService(suite.ctx, suite.client, suite.build)
+
+	// Assert
+	require.NotNil(suite.T(), err)
+	require.Contains(suite.T(), err.Error(), "plugin mock cannot run tests")
+}
+
+func (suite *multiTestSuite) TestTestSucceeds() {
+	// Arrange
+	suite.setupTestTarget()
+	state := llb.Scratch()
+	plugin := testerPlugin{packer2llb_mock.NewMockPlugin(suite.ctrl), &state}
+	plugin.EXPECT().
+		Detect(gomock.Any(), gomock.Any(), gomock.Any()).
+		Return(&packer2llb.Detection{}, nil)
+	packer2llb.Register(plugin)
+
+	res := client.NewResult()
+	res.SetRef(cib_mock.NewMockReference(suite.ctrl))
+	suite.client.EXPECT().
+		Solve(gomock.Any(), gomock.Any()).
+		Return(res, nil)
+
+	// Act
+	res, err := BuildWithService(suite.ctx, suite.client, suite.build)
+
+	// Assert
+	require.Nil(suite.T(), err)
+	require.NotNil(suite.T(), res.Ref)
+	require.NotContains(suite.T(), res.Metadata, exptypes.ExporterImageConfigKey)
+}
+
 func TestMultiPlatform(t *testing.T) {
 	suite.Run(t, new(multiTestSuite))
 }
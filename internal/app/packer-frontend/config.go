@@ -0,0 +1,99 @@
+package frontend
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/EricHripko/pack.yaml/pkg/packer2llb/config"
+
+	"github.com/EricHripko/buildkit-fdk/pkg/cib"
+	"github.com/moby/buildkit/client/llb"
+	dockerfile "github.com/moby/buildkit/frontend/dockerfile/builder"
+	"github.com/moby/buildkit/frontend/dockerfile/dockerfile2llb"
+	"github.com/moby/buildkit/frontend/gateway/client"
+	"github.com/moby/buildkit/solver/errdefs"
+	"github.com/moby/buildkit/solver/pb"
+	"github.com/pkg/errors"
+)
+
+const (
+	// Frontend option that controls whether pack.yaml is validated strictly
+	// (enabled by default).
+	keyStrict = "strict"
+	// Frontend option that selects the profile from pack.yaml (set with
+	// docker build --target).
+	keyTarget = "target"
+	// Build target that exports the built binaries instead of the image.
+	targetArtifacts = "artifacts"
+	// Build target that runs the tests and exports the test reports instead
+	// of the image.
+	targetTest = "test"
+)
+
+// Reads the configuration for the build.
+func readConfig(ctx context.Context, svc cib.Service, data []byte) (*config.Config, error) {
+	var err error
+	buildOpts := svc.GetOpts()
+	target := buildOpts[keyTarget]
+	if target == targetArtifacts || target == targetTest {
+		target = ""
+	}
+	opts := config.Options{
+		Filename:  svc.GetMetadataFileName(),
+		Strict:    true,
+		Target:    target,
+		BuildArgs: svc.GetBuildArgs(),
+		Loader:    config.ContextLoader(ctx, svc),
+	}
+	if v, ok := buildOpts[keyStrict]; ok {
+		opts.Strict, err = strconv.ParseBool(v)
+		if err != nil {
+			return nil, errors.Errorf("frontend: invalid value %q for %s option", v, keyStrict)
+		}
+	}
+
+	return config.ReadWithOptions(data, opts)
+}
+
+// Attaches the location of the problems in pack.yaml to the error, so that
+// the client can highlight the offending lines.
+func withSource(ctx context.Context, c client.Client, svc cib.Service, data []byte, err error) error {
+	var errs config.Errors
+	if !errors.As(err, &errs) {
+		return err
+	}
+
+	// Same definition as the one used to load the metadata
+	filename := svc.GetMetadataFileName()
+	src := llb.Local(dockerfile.DefaultLocalNameDockerfile,
+		llb.FollowPaths([]string{filename}),
+		llb.SessionID(c.BuildOpts().SessionID),
+		llb.SharedKeyHint(dockerfile.DefaultLocalNameDockerfile),
+		dockerfile2llb.WithInternalName("load build definition from "+filename),
+	)
+	def, defErr := src.Marshal(ctx)
+	if defErr != nil {
+		return err
+	}
+
+	source := errdefs.Source{
+		Info: &pb.SourceInfo{
+			Filename:   filename,
+			Data:       data,
+			Definition: def.ToPB(),
+		},
+	}
+	for _, e := range errs {
+		if e.Line == 0 || (e.Filename != "" && e.Filename != filename) {
+			continue
+		}
+		source.Ranges = append(source.Ranges, &pb.Range{
+			Start: pb.Position{Line: int32(e.Line), Character: int32(e.Column)},
+			End:   pb.Position{Line: int32(e.Line), Character: int32(e.Column)},
+		})
+	}
+	if len(source.Ranges) == 0 {
+		return err
+	}
+	return errdefs.WithSource(err, source)
+}
@@ -0,0 +1,177 @@
+package frontend
+
+import (
+	"context"
+	"testing"
+
+	"github.com/EricHripko/pack.yaml/pkg/packer2llb/config"
+
+	cib_mock "github.com/EricHripko/buildkit-fdk/pkg/cib/mock"
+	"github.com/golang/mock/gomock"
+	"github.com/moby/buildkit/frontend/gateway/client"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type readConfigTestSuite struct {
+	suite.Suite
+	ctrl  *gomock.Controller
+	ctx   context.Context
+	build *cib_mock.MockService
+}
+
+func (suite *readConfigTestSuite) SetupTest() {
+	suite.ctrl = gomock.NewController(suite.T())
+	suite.ctx = context.Background()
+	suite.build = cib_mock.NewMockService(suite.ctrl)
+	suite.build.EXPECT().
+		GetMetadataFileName().
+		Return("pack.yaml").
+		AnyTimes()
+	suite.build.EXPECT().
+		GetBuildArgs().
+		Return(map[string]string{"VERSION": "1.0.0"}).
+		AnyTimes()
+}
+
+func (suite *readConfigTestSuite) TearDownTest() {
+	suite.ctrl.Finish()
+}
+
+func (suite *readConfigTestSuite) TestStrictByDefault() {
+	// Arrange
+	suite.build.EXPECT().
+		GetOpts().
+		Return(map[string]string{})
+
+	// Act
+	_, err := readConfig(suite.ctx, suite.build, []byte("usr: somebody"))
+
+	// Assert
+	require.IsType(suite.T(), config.Errors{}, err)
+}
+
+func (suite *readConfigTestSuite) TestStrictDisabled() {
+	// Arrange
+	suite.build.EXPECT().
+		GetOpts().
+		Return(map[string]string{keyStrict: "false"})
+
+	// Act
+	cfg, err := readConfig(suite.ctx, suite.build, []byte("usr: somebody"))
+
+	// Assert
+	require.Nil(suite.T(), err)
+	require.Equal(suite.T(), "somebody", cfg.Other["usr"])
+}
+
+func (suite *readConfigTestSuite) TestStrictInvalid() {
+	// Arrange
+	suite.build.EXPECT().
+		GetOpts().
+		Return(map[string]string{keyStrict: "maybe"})
+
+	// Act
+	_, err := readConfig(suite.ctx, suite.build, []byte(""))
+
+	// Assert
+	require.NotNil(suite.T(), err)
+	require.Contains(suite.T(), err.Error(), keyStrict)
+}
+
+func (suite *readConfigTestSuite) TestTarget() {
+	// Arrange
+	suite.build.EXPECT().
+		GetOpts().
+		Return(map[string]string{keyTarget: "prod"})
+	data := []byte(`
+debug: true
+profiles:
+  prod:
+    debug: false
+`)
+
+	// Act
+	cfg, err := readConfig(suite.ctx, suite.build, data)
+
+	// Assert
+	require.Nil(suite.T(), err)
+	require.False(suite.T(), cfg.Debug)
+}
+
+func (suite *readConfigTestSuite) TestUnknownTarget() {
+	// Arrange
+	suite.build.EXPECT().
+		GetOpts().
+		Return(map[string]string{keyTarget: "prod"})
+
+	// Act
+	_, err := readConfig(suite.ctx, suite.build, []byte("debug: true"))
+
+	// Assert
+	require.NotNil(suite.T(), err)
+	require.Contains(suite.T(), err.Error(), `unknown target "prod"`)
+}
+
+func (suite *readConfigTestSuite) TestArtifactsTarget() {
+	// Arrange
+	suite.build.EXPECT().
+		GetOpts().
+		Return(map[string]string{keyTarget: targetArtifacts})
+
+	// Act
+	cfg, err := readConfig(suite.ctx, suite.build, []byte("debug: true"))
+
+	// Assert
+	require.Nil(suite.T(), err)
+	require.True(suite.T(), cfg.Debug)
+}
+
+func (suite *readConfigTestSuite) TestBuildArgs() {
+	// Arrange
+	suite.build.EXPECT().
+		GetOpts().
+		Return(map[string]string{})
+	data := []byte(`
+env:
+  VERSION: ${VERSION}
+`)
+
+	// Act
+	cfg, err := readConfig(suite.ctx, suite.build, data)
+
+	// Assert
+	require.Nil(suite.T(), err)
+	require.Equal(suite.T(), "1.0.0", cfg.Env["VERSION"])
+}
+
+func (suite *readConfigTestSuite) TestExtends() {
+	// Arrange
+	suite.build.EXPECT().
+		GetOpts().
+		Return(map[string]string{})
+	src := cib_mock.NewMockReference(suite.ctrl)
+	suite.build.EXPECT().
+		Src().
+		Return(src, nil)
+	req := client.ReadRequest{Filename: "base.pack.yaml"}
+	src.EXPECT().
+		ReadFile(suite.ctx, req).
+		Return([]byte("user: somebody"), nil)
+	data := []byte(`
+extends: base.pack.yaml
+debug: false
+`)
+
+	// Act
+	cfg, err := readConfig(suite.ctx, suite.build, data)
+
+	// Assert
+	require.Nil(suite.T(), err)
+	require.False(suite.T(), cfg.Debug)
+	require.Equal(suite.T(), "somebody", cfg.User)
+}
+
+func TestReadConfig(t *testing.T) {
+	suite.Run(t, new(readConfigTestSuite))
+}
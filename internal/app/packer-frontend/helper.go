@@ -2,25 +2,40 @@ package frontend
 
 import (
 	"context"
-	"errors"
+	"encoding/json"
 	"os"
+	"path"
+	"regexp"
+	"sort"
 	"strings"
 
 	"github.com/EricHripko/pack.yaml/pkg/packer2llb"
+	"github.com/EricHripko/pack.yaml/pkg/packer2llb/config"
 
 	"github.com/EricHripko/buildkit-fdk/pkg/cib"
+	"github.com/moby/buildkit/frontend/dockerfile/dockerfile2llb"
 	"github.com/moby/buildkit/frontend/gateway/client"
+	"github.com/pkg/errors"
 	fsutil "github.com/tonistiigi/fsutil/types"
 )
 
+// User that the image runs as when neither the configuration nor the runtime
+// image set one.
+const defaultUser = "nobody"
+
 // Returned when no command was found in the produced image.
 var errNoCommand = errors.New("frontend: no command found")
 
+// Regular expression for a major version suffix of a project (e.g., v2 in
+// example.com/app/v2).
+var majorRegex = regexp.MustCompile(`^v[0-9]+$`)
+
 // Looks in the known install directory and attempts to automatically detect
 // the command for the image.
-func findCommand(ctx context.Context, ref client.Reference) (command string, err error) {
+func findCommand(ctx context.Context, ref client.Reference, main string, project string) (string, error) {
 	prefix := packer2llb.DirInstall[1:]
-	err = cib.WalkRecursive(ctx, ref, func(file *fsutil.Stat) error {
+	var commands []string
+	err := cib.WalkRecursive(ctx, ref, func(file *fsutil.Stat) error {
 		// Must be in install location
 		if !strings.HasPrefix(file.Path, prefix) {
 			return nil
@@ -33,15 +48,199 @@ func findCommand(ctx context.Context, ref client.Reference) (command string, err
 		if file.Mode&0100 == 0 {
 			return nil
 		}
-		// Multiple commands found
-		if command != "" {
-			return errors.New("frontend: multiple commands found (" + command + ")")
-		}
-		command = "/" + file.Path
+		commands = append(commands, "/"+file.Path)
 		return nil
 	})
-	if command == "" {
-		err = errNoCommand
+	if err != nil {
+		return "", err
+	}
+	return selectCommand(commands, main, project)
+}
+
+// Chooses the command for the image from the binaries reported by the
+// plugin, falling back to looking in the known install directory.
+func chooseCommand(ctx context.Context, ref client.Reference, main string, detection *packer2llb.Detection) (string, error) {
+	if len(detection.Binaries) == 0 {
+		return findCommand(ctx, ref, main, detection.Project)
+	}
+	commands := make([]string, 0, len(detection.Binaries))
+	for _, binary := range detection.Binaries {
+		commands = append(commands, path.Join(packer2llb.DirInstall, binary))
+	}
+	return selectCommand(commands, main, detection.Project)
+}
+
+// Selects the command out of the candidates. The command named in the
+// configuration takes precedence, followed by the command named after the
+// project.
+func selectCommand(commands []string, main string, project string) (string, error) {
+	if len(commands) == 0 {
+		return "", errNoCommand
+	}
+	sort.Strings(commands)
+	list := strings.Join(commands, ", ")
+
+	// Explicit choice
+	if main != "" {
+		for _, command := range commands {
+			if command == main || path.Base(command) == main {
+				return command, nil
+			}
+		}
+		return "", errors.Errorf("frontend: main command %s not found (%s)", main, list)
+	}
+	if len(commands) == 1 {
+		return commands[0], nil
+	}
+
+	// Named after the project
+	if name := projectName(project); name != "" {
+		for _, command := range commands {
+			if path.Base(command) == name {
+				return command, nil
+			}
+		}
+	}
+	return "", errors.Errorf(
+		"frontend: multiple commands found (%s), choose one by adding \"main: %s\" to pack.yaml",
+		list,
+		path.Base(commands[0]),
+	)
+}
+
+// Returns the name of the project (i.e., the last element of its path
+// without the major version suffix).
+func projectName(project string) string {
+	if project == "" {
+		return ""
+	}
+	name := path.Base(project)
+	if majorRegex.MatchString(name) {
+		name = path.Base(path.Dir(project))
+	}
+	return name
+}
+
+// Applies the configuration to the image and returns the image
+// configuration in the format expected by the exporter.
+func imageConfig(ctx context.Context, img *dockerfile2llb.Image, ref client.Reference, cfg *config.Config, detection *packer2llb.Detection) ([]byte, error) {
+	setUser(img, cfg.User)
+	if len(cfg.Entrypoint) > 0 || len(cfg.Command) > 0 {
+		// Pre-defined command
+		img.Config.Entrypoint = cfg.Entrypoint
+		img.Config.Cmd = cfg.Command
+	} else {
+		// Find command
+		cmd, err := chooseCommand(ctx, ref, cfg.Main, detection)
+		if err != nil {
+			return nil, err
+		}
+		img.Config.Entrypoint = []string{}
+		img.Config.Cmd = []string{cmd}
+	}
+	setEnv(img, cfg.Env)
+	setImageConfig(img, cfg)
+	if err := setHealthcheck(ctx, img, ref, cfg.Healthcheck); err != nil {
+		return nil, err
+	}
+
+	config, err := json.Marshal(img)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to marshal image config")
+	}
+	return config, nil
+}
+
+// Sets the user of the image. Without one in the configuration, the user of
+// the runtime image is kept (e.g., nonroot) and nobody is used otherwise.
+func setUser(img *dockerfile2llb.Image, user string) {
+	if user != "" {
+		img.Config.User = user
+	} else if img.Config.User == "" {
+		img.Config.User = defaultUser
+	}
+}
+
+// Merges the environment variables into the image configuration. Variables
+// inherited from the base image (e.g., PATH) are kept unless overridden.
+func setEnv(img *dockerfile2llb.Image, env map[string]string) {
+	keys := make([]string, 0, len(env))
+	for key := range env {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		img.Config.Env = addEnv(img.Config.Env, key, env[key])
+	}
+}
+
+// Sets the variable in the list of KEY=VALUE pairs.
+func addEnv(env []string, key, value string) []string {
+	prefix := key + "="
+	for i, kv := range env {
+		if strings.HasPrefix(kv, prefix) {
+			env[i] = prefix + value
+			return env
+		}
+	}
+	return append(env, prefix+value)
+}
+
+// Populates the runtime settings of the image configuration.
+func setImageConfig(img *dockerfile2llb.Image, cfg *config.Config) {
+	if ports := cfg.ExposedPorts(); len(ports) > 0 {
+		if img.Config.ExposedPorts == nil {
+			img.Config.ExposedPorts = make(map[string]struct{})
+		}
+		for port := range ports {
+			img.Config.ExposedPorts[port] = struct{}{}
+		}
+	}
+	if len(cfg.Volumes) > 0 {
+		if img.Config.Volumes == nil {
+			img.Config.Volumes = make(map[string]struct{})
+		}
+		for _, volume := range cfg.Volumes {
+			img.Config.Volumes[volume] = struct{}{}
+		}
+	}
+	if len(cfg.Labels) > 0 {
+		if img.Config.Labels == nil {
+			img.Config.Labels = make(map[string]string)
+		}
+		for key, value := range cfg.Labels {
+			img.Config.Labels[key] = value
+		}
+	}
+	if cfg.WorkDir != "" {
+		img.Config.WorkingDir = cfg.WorkDir
+	}
+	if cfg.StopSignal != "" {
+		img.Config.StopSignal = cfg.StopSignal
+	}
+}
+
+// Sets the health check for the image. Validates that the command it
+// executes is present in the image (relative to the install location).
+func setHealthcheck(ctx context.Context, img *dockerfile2llb.Image, ref client.Reference, hc *config.Healthcheck) error {
+	if hc == nil {
+		return nil
+	}
+	if binary := hc.Test.Binary(); binary != "" {
+		if !path.IsAbs(binary) {
+			binary = path.Join(packer2llb.DirInstall, binary)
+		}
+		if _, err := ref.StatFile(ctx, client.StatRequest{Path: binary}); err != nil {
+			return errors.Errorf("frontend: healthcheck command %s not found", binary)
+		}
+	}
+	img.Config.Healthcheck = &dockerfile2llb.HealthConfig{
+		Test:        hc.Test,
+		Interval:    hc.Interval,
+		Timeout:     hc.Timeout,
+		StartPeriod: hc.StartPeriod,
+		Retries:     hc.Retries,
 	}
-	return
+	return nil
 }
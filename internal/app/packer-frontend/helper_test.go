@@ -2,11 +2,18 @@ package frontend
 
 import (
 	"context"
+	"errors"
 	"os"
 	"testing"
+	"time"
+
+	"github.com/EricHripko/pack.yaml/pkg/packer2llb"
+	"github.com/EricHripko/pack.yaml/pkg/packer2llb/config"
 
 	cib_mock "github.com/EricHripko/buildkit-fdk/pkg/cib/mock"
 	"github.com/golang/mock/gomock"
+	"github.com/moby/buildkit/frontend/dockerfile/dockerfile2llb"
+	"github.com/moby/buildkit/frontend/gateway/client"
 	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 	fsutil "github.com/tonistiigi/fsutil/types"
@@ -37,7 +44,7 @@ func (suite *findCommandTestSuite) TestNotFound() {
 		Return(files, nil)
 
 	// Act
-	cmd, err := findCommand(suite.ctx, suite.ref)
+	cmd, err := findCommand(suite.ctx, suite.ref, "", "")
 
 	// Assert
 	require.Empty(suite.T(), cmd)
@@ -54,7 +61,7 @@ func (suite *findCommandTestSuite) TestIgnoresNonPrefix() {
 		Return(files, nil)
 
 	// Act
-	cmd, err := findCommand(suite.ctx, suite.ref)
+	cmd, err := findCommand(suite.ctx, suite.ref, "", "")
 
 	// Assert
 	require.Empty(suite.T(), cmd)
@@ -74,7 +81,7 @@ func (suite *findCommandTestSuite) TestIgnoresDirs() {
 		Return([]*fsutil.Stat{}, nil)
 
 	// Act
-	cmd, err := findCommand(suite.ctx, suite.ref)
+	cmd, err := findCommand(suite.ctx, suite.ref, "", "")
 
 	// Assert
 	require.Empty(suite.T(), cmd)
@@ -91,7 +98,7 @@ func (suite *findCommandTestSuite) TestIgnoresNonExecutable() {
 		Return(files, nil)
 
 	// Act
-	cmd, err := findCommand(suite.ctx, suite.ref)
+	cmd, err := findCommand(suite.ctx, suite.ref, "", "")
 
 	// Assert
 	require.Empty(suite.T(), cmd)
@@ -109,7 +116,7 @@ func (suite *findCommandTestSuite) TestMultipleCommands() {
 		Return(files, nil)
 
 	// Act
-	_, err := findCommand(suite.ctx, suite.ref)
+	_, err := findCommand(suite.ctx, suite.ref, "", "")
 
 	// Assert
 	require.NotNil(suite.T(), err)
@@ -127,7 +134,25 @@ func (suite *findCommandTestSuite) TestSucceeds() {
 		Return(files, nil)
 
 	// Act
-	cmd, err := findCommand(suite.ctx, suite.ref)
+	cmd, err := findCommand(suite.ctx, suite.ref, "", "")
+
+	// Assert
+	require.Equal(suite.T(), "/usr/local/bin/hello", cmd)
+	require.Nil(suite.T(), err)
+}
+
+func (suite *findCommandTestSuite) TestMultipleCommandsProject() {
+	// Arrange
+	files := []*fsutil.Stat{
+		{Path: "usr/local/bin/hello", Mode: 0755},
+		{Path: "usr/local/bin/tool", Mode: 0755},
+	}
+	suite.ref.EXPECT().
+		ReadDir(suite.ctx, gomock.Any()).
+		Return(files, nil)
+
+	// Act
+	cmd, err := findCommand(suite.ctx, suite.ref, "", "github.com/example/hello/v2")
 
 	// Assert
 	require.Equal(suite.T(), "/usr/local/bin/hello", cmd)
@@ -137,3 +162,221 @@ func (suite *findCommandTestSuite) TestSucceeds() {
 func TestFindCommand(t *testing.T) {
 	suite.Run(t, new(findCommandTestSuite))
 }
+
+func TestChooseCommand(t *testing.T) {
+	// Arrange
+	detection := &packer2llb.Detection{Binaries: []string{"hello"}}
+
+	// Act
+	cmd, err := chooseCommand(context.Background(), nil, "", detection)
+
+	// Assert
+	require.Nil(t, err)
+	require.Equal(t, "/usr/local/bin/hello", cmd)
+}
+
+func TestSelectCommandMain(t *testing.T) {
+	// Arrange
+	commands := []string{"/usr/local/bin/hello", "/usr/local/bin/world"}
+
+	// Act
+	cmd, err := selectCommand(commands, "world", "github.com/example/hello")
+
+	// Assert
+	require.Nil(t, err)
+	require.Equal(t, "/usr/local/bin/world", cmd)
+}
+
+func TestSelectCommandMainNotFound(t *testing.T) {
+	// Arrange
+	commands := []string{"/usr/local/bin/hello"}
+
+	// Act
+	_, err := selectCommand(commands, "world", "")
+
+	// Assert
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "main command world not found (/usr/local/bin/hello)")
+}
+
+func TestSelectCommandMultiple(t *testing.T) {
+	// Arrange
+	commands := []string{"/usr/local/bin/world", "/usr/local/bin/hello"}
+
+	// Act
+	_, err := selectCommand(commands, "", "github.com/example/app")
+
+	// Assert
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "multiple commands found (/usr/local/bin/hello, /usr/local/bin/world)")
+	require.Contains(t, err.Error(), `"main: hello"`)
+}
+
+func TestSetUser(t *testing.T) {
+	cases := map[string]struct {
+		base     string
+		user     string
+		expected string
+	}{
+		"default":  {base: "", user: "", expected: "nobody"},
+		"scratch":  {base: "65534", user: "", expected: "65534"},
+		"nonroot":  {base: "nonroot", user: "", expected: "nonroot"},
+		"override": {base: "nonroot", user: "somebody", expected: "somebody"},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			// Arrange
+			img := &dockerfile2llb.Image{}
+			img.Config.User = c.base
+
+			// Act
+			setUser(img, c.user)
+
+			// Assert
+			require.Equal(t, c.expected, img.Config.User)
+		})
+	}
+}
+
+func TestSetEnv(t *testing.T) {
+	// Arrange
+	img := &dockerfile2llb.Image{}
+	img.Config.Env = []string{"PATH=/usr/bin", "HOME=/root"}
+	env := map[string]string{
+		"HOME":    "/home/nobody",
+		"VERSION": "1.0.0",
+		"MODE":    "release",
+	}
+
+	// Act
+	setEnv(img, env)
+
+	// Assert
+	require.Equal(t, []string{
+		"PATH=/usr/bin",
+		"HOME=/home/nobody",
+		"MODE=release",
+		"VERSION=1.0.0",
+	}, img.Config.Env)
+}
+
+func TestSetImageConfig(t *testing.T) {
+	// Arrange
+	img := &dockerfile2llb.Image{}
+	img.Config.Labels = map[string]string{"base": "distroless"}
+	cfg := config.New()
+	cfg.Ports = []string{"8080", "53/udp"}
+	cfg.Volumes = []string{"/data"}
+	cfg.WorkDir = "/data"
+	cfg.StopSignal = "SIGINT"
+	cfg.Labels = map[string]string{"app": "hello"}
+
+	// Act
+	setImageConfig(img, cfg)
+
+	// Assert
+	require.Equal(t, map[string]struct{}{
+		"8080/tcp": {},
+		"53/udp":   {},
+	}, img.Config.ExposedPorts)
+	require.Equal(t, map[string]struct{}{"/data": {}}, img.Config.Volumes)
+	require.Equal(t, "/data", img.Config.WorkingDir)
+	require.Equal(t, "SIGINT", img.Config.StopSignal)
+	require.Equal(t, map[string]string{
+		"base": "distroless",
+		"app":  "hello",
+	}, img.Config.Labels)
+}
+
+type setHealthcheckTestSuite struct {
+	suite.Suite
+	ctrl *gomock.Controller
+	ctx  context.Context
+	ref  *cib_mock.MockReference
+	img  *dockerfile2llb.Image
+}
+
+func (suite *setHealthcheckTestSuite) SetupTest() {
+	suite.ctrl = gomock.NewController(suite.T())
+	suite.ctx = context.Background()
+	suite.ref = cib_mock.NewMockReference(suite.ctrl)
+	suite.img = &dockerfile2llb.Image{}
+}
+
+func (suite *setHealthcheckTestSuite) TearDownTest() {
+	suite.ctrl.Finish()
+}
+
+func (suite *setHealthcheckTestSuite) TestNone() {
+	// Act
+	err := setHealthcheck(suite.ctx, suite.img, suite.ref, nil)
+
+	// Assert
+	require.Nil(suite.T(), err)
+	require.Nil(suite.T(), suite.img.Config.Healthcheck)
+}
+
+func (suite *setHealthcheckTestSuite) TestShell() {
+	// Arrange
+	hc := &config.Healthcheck{
+		Test:     config.HealthcheckTest{"CMD-SHELL", "wget -q localhost"},
+		Interval: time.Second,
+		Retries:  3,
+	}
+
+	// Act
+	err := setHealthcheck(suite.ctx, suite.img, suite.ref, hc)
+
+	// Assert
+	require.Nil(suite.T(), err)
+	require.Equal(suite.T(), &dockerfile2llb.HealthConfig{
+		Test:     []string{"CMD-SHELL", "wget -q localhost"},
+		Interval: time.Second,
+		Retries:  3,
+	}, suite.img.Config.Healthcheck)
+}
+
+func (suite *setHealthcheckTestSuite) TestBinaryNotFound() {
+	// Arrange
+	hc := &config.Healthcheck{
+		Test: config.HealthcheckTest{"CMD", "hello", "health"},
+	}
+	req := client.StatRequest{Path: "/usr/local/bin/hello"}
+	suite.ref.EXPECT().
+		StatFile(suite.ctx, req).
+		Return(nil, errors.New("not found"))
+
+	// Act
+	err := setHealthcheck(suite.ctx, suite.img, suite.ref, hc)
+
+	// Assert
+	require.NotNil(suite.T(), err)
+	require.Contains(suite.T(), err.Error(), "/usr/local/bin/hello")
+	require.Nil(suite.T(), suite.img.Config.Healthcheck)
+}
+
+func (suite *setHealthcheckTestSuite) TestBinaryFound() {
+	// Arrange
+	hc := &config.Healthcheck{
+		Test: config.HealthcheckTest{"CMD", "/usr/local/bin/hello", "health"},
+	}
+	req := client.StatRequest{Path: "/usr/local/bin/hello"}
+	suite.ref.EXPECT().
+		StatFile(suite.ctx, req).
+		Return(&fsutil.Stat{Path: "usr/local/bin/hello", Mode: 0755}, nil)
+
+	// Act
+	err := setHealthcheck(suite.ctx, suite.img, suite.ref, hc)
+
+	// Assert
+	require.Nil(suite.T(), err)
+	require.Equal(
+		suite.T(),
+		[]string{"CMD", "/usr/local/bin/hello", "health"},
+		suite.img.Config.Healthcheck.Test,
+	)
+}
+
+func TestSetHealthcheck(t *testing.T) {
+	suite.Run(t, new(setHealthcheckTestSuite))
+}
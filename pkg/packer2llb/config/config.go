@@ -1,8 +1,16 @@
 package config
 
 import (
+	"fmt"
+	"path"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
 	"github.com/mitchellh/mapstructure"
-	"gopkg.in/yaml.v2"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
 )
 
 // Config that drives that image creation. Typically stored in pack.yaml file.
@@ -13,11 +21,54 @@ type Config struct {
 	Entrypoint []string
 	// Command for the resulting image.
 	Command []string
-	// User to be used in the resulting image.
+	// Name of the installed binary to use as the command when several are
+	// present (e.g., server).
+	Main string
+	// User to be used in the resulting image. If empty, the user of the
+	// runtime image is kept (nobody if the runtime image doesn't set one).
 	User string
+	// Environment variables for the resulting image.
+	Env map[string]string
+	// Ports exposed by the resulting image (e.g., 8080/tcp).
+	Ports []string
+	// Volumes declared by the resulting image.
+	Volumes []string
+	// Working directory for the resulting image.
+	WorkDir string `mapstructure:"workdir"`
+	// Signal used to stop the container (e.g., SIGTERM).
+	StopSignal string
+	// Labels for the resulting image.
+	Labels map[string]string
+	// Health check for the resulting image.
+	Healthcheck *Healthcheck
+	// Name of the plugin to use for the project (detected automatically if
+	// omitted).
+	Plugin string
 	// Other configuration fields. Typically used by plugins for additional
 	// settings.
 	Other map[string]interface{} `mapstructure:",remain"`
+
+	// Options used to read the configuration.
+	opts Options
+	// Document that the configuration was read from.
+	node *yaml.Node
+	// Files that the nodes of the document came from (if not the main file).
+	origins map[*yaml.Node]string
+}
+
+// Options that control how the configuration is read.
+type Options struct {
+	// Name of the file that the configuration is read from.
+	Filename string
+	// Whether unknown keys and values of wrong type should be reported.
+	Strict bool
+	// Name of the profile to apply on top of the configuration (e.g., prod).
+	Target string
+	// Build arguments that can be referenced by the values (e.g.,
+	// ${VERSION:-1.16}).
+	BuildArgs map[string]string
+	// Loader for the files referenced with extends.
+	Loader Loader
 }
 
 // New returns an instance of configuration with pre-populated defaults.
@@ -26,21 +77,209 @@ func New() *Config {
 		Debug:      true,
 		Entrypoint: []string{},
 		Command:    []string{},
-		User:       "nobody",
+		Env:        make(map[string]string),
+		Ports:      []string{},
+		Volumes:    []string{},
+		Labels:     make(map[string]string),
 		Other:      make(map[string]interface{}),
 	}
 }
 
-// Read the configuration provided into a structured format.
+// Read the configuration provided into a structured format (in strict
+// mode).
 func Read(data []byte) (*Config, error) {
-	// Decode YAML
+	return ReadWithOptions(data, Options{Filename: "pack.yaml", Strict: true})
+}
+
+// ReadWithOptions reads the configuration provided into a structured format
+// using the specified options.
+func ReadWithOptions(data []byte, opts Options) (*Config, error) {
+	config := New()
+	config.opts = opts
+	config.origins = make(map[*yaml.Node]string)
+
+	// Decode YAML (along with the configuration it extends)
+	root, err := config.load(data, opts.Filename, nil)
+	if err != nil {
+		return nil, config.locate(err)
+	}
+	if root == nil {
+		return config, nil
+	}
+	root, profiles := config.split(root, keyProfiles)
+	config.node = root
+	if err := interpolateProfiles(profiles, opts.BuildArgs, opts.Target).err(); err != nil {
+		return nil, config.locate(err)
+	}
+	if opts.Strict {
+		errs := check(root, reflect.TypeOf(config), "")
+		errs = append(errs, checkProfiles(profiles)...)
+		if err := errs.err(); err != nil {
+			return nil, config.locate(err)
+		}
+	}
+	node, err := config.applyProfile(root, profiles, opts.Target)
+	if err != nil {
+		return nil, err
+	}
+	config.node = node
+	keepDecimals(config.node)
 	m := make(map[string]interface{})
-	if err := yaml.Unmarshal(data, m); err != nil {
+	if err := config.node.Decode(&m); err != nil {
 		return nil, err
 	}
 
 	// Map
-	config := New()
-	err := mapstructure.Decode(m, config)
-	return config, err
+	if err := decode(m, config); err != nil {
+		return config, err
+	}
+	return config, config.locate(config.Validate())
+}
+
+// Marks the decimal numbers as strings, so that they are decoded exactly as
+// written (e.g., version: 1.20 must not become 1.2).
+func keepDecimals(node *yaml.Node) {
+	if node.Kind == yaml.ScalarNode && node.ShortTag() == "!!float" {
+		node.Tag = "!!str"
+	}
+	for _, child := range node.Content {
+		keepDecimals(child)
+	}
+}
+
+// Section decodes the configuration of a plugin stored under the specified
+// top-level key (e.g., go).
+func (c *Config) Section(key string, output interface{}) error {
+	raw, ok := c.Other[key]
+	if !ok {
+		return nil
+	}
+	if c.opts.Strict && c.node != nil {
+		node := lookup(c.node, key)
+		err := check(node, reflect.TypeOf(output), key).err()
+		if err != nil {
+			return c.locate(err)
+		}
+	}
+	return decode(raw, output)
+}
+
+// Validate that the configuration values are well-formed.
+func (c *Config) Validate() error {
+	var errs Errors
+	for i, port := range c.Ports {
+		if _, err := parsePort(port); err != nil {
+			errs = append(errs, newError(joinPath("ports", i), "%s", err))
+		}
+	}
+	for i, volume := range c.Volumes {
+		if !path.IsAbs(volume) {
+			errs = append(errs, newError(joinPath("volumes", i), "%q must be an absolute path", volume))
+		}
+	}
+	if c.WorkDir != "" && !path.IsAbs(c.WorkDir) {
+		errs = append(errs, newError("workdir", "%q must be an absolute path", c.WorkDir))
+	}
+	if c.StopSignal != "" && !signalRegex.MatchString(c.StopSignal) {
+		errs = append(errs, newError("stopSignal", "invalid stop signal %q", c.StopSignal))
+	}
+	if c.Healthcheck != nil {
+		errs = append(errs, c.Healthcheck.validate("healthcheck")...)
+	}
+	return errs.err()
+}
+
+// ErrorAt returns a problem with the value at the specified path (e.g.,
+// go.auth.ssh) along with its location in the document.
+func (c *Config) ErrorAt(path string, format string, args ...interface{}) error {
+	return c.locate(Errors{newError(path, format, args...)})
+}
+
+// Attaches the location in the document to the problems in the
+// configuration.
+func (c *Config) locate(err error) error {
+	errs, ok := err.(Errors)
+	if !ok {
+		return err
+	}
+	for _, e := range errs {
+		if e.node == nil && c.node != nil {
+			e.node = lookup(c.node, e.Path)
+			e.Line = e.node.Line
+			e.Column = e.node.Column
+		}
+		e.Filename = c.opts.Filename
+		if file, ok := c.origins[e.node]; ok {
+			e.Filename = file
+		}
+	}
+	return err
+}
+
+// ExposedPorts returns the ports in the format used by the image config
+// (e.g., 8080 becomes 8080/tcp).
+func (c *Config) ExposedPorts() map[string]struct{} {
+	ports := make(map[string]struct{}, len(c.Ports))
+	for _, port := range c.Ports {
+		if normalised, err := parsePort(port); err == nil {
+			ports[normalised] = struct{}{}
+		}
+	}
+	return ports
+}
+
+// Regular expression for a signal name (e.g., SIGTERM or SIGRTMIN+3) or
+// number.
+var signalRegex = regexp.MustCompile(`^(?:SIG[A-Z0-9]+(?:[+-][0-9]+)?|[0-9]+)$`)
+
+// Parses the port specification and returns it in the normalised
+// <port>/<protocol> format.
+func parsePort(port string) (string, error) {
+	parts := strings.SplitN(port, "/", 2)
+	proto := "tcp"
+	if len(parts) == 2 {
+		proto = parts[1]
+	}
+	number, err := strconv.Atoi(parts[0])
+	if err != nil || number < 1 || number > 65535 {
+		return "", errors.Errorf("invalid port %q", port)
+	}
+	switch proto {
+	case "tcp", "udp", "sctp":
+	default:
+		return "", errors.Errorf("invalid protocol for port %q", port)
+	}
+	return fmt.Sprintf("%d/%s", number, proto), nil
+}
+
+// Decode the raw configuration into a structured format.
+func decode(input interface{}, output interface{}) error {
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		DecodeHook: mapstructure.ComposeDecodeHookFunc(
+			scalarToString,
+			stringToHealthcheckTest,
+			mapstructure.StringToTimeDurationHookFunc(),
+		),
+		Result: output,
+	})
+	if err != nil {
+		return err
+	}
+	return decoder.Decode(input)
+}
+
+// Allows numbers and booleans to be used where a string is expected (e.g.,
+// PORT: 8080 in the environment variables).
+func scalarToString(from reflect.Type, to reflect.Type, data interface{}) (interface{}, error) {
+	if to.Kind() != reflect.String {
+		return data, nil
+	}
+	switch from.Kind() {
+	case reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return fmt.Sprint(data), nil
+	}
+	return data, nil
 }
@@ -2,6 +2,7 @@ package config
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
@@ -14,17 +15,37 @@ func TestNewConfig(t *testing.T) {
 	require.True(t, cfg.Debug)
 	require.Empty(t, cfg.Entrypoint)
 	require.Empty(t, cfg.Command)
-	require.Equal(t, cfg.User, "nobody")
+	require.Empty(t, cfg.User)
+	require.Empty(t, cfg.Env)
+	require.Empty(t, cfg.Ports)
+	require.Empty(t, cfg.Volumes)
+	require.Empty(t, cfg.Labels)
 	require.Empty(t, cfg.Other)
 }
 
 func TestReadConfig_Valid(t *testing.T) {
 	// Arrange
+	RegisterSection("go", nil)
 	data := []byte(`
 debug: false
 entrypoint: ["entrypoint"]
 command: ["command"]
 user: somebody
+env:
+    NAME: value
+    PORT: 8080
+ports: ["8080", "53/udp"]
+volumes: ["/data"]
+workdir: /data
+stopSignal: SIGINT
+labels:
+    app: hello
+healthcheck:
+    test: ["hello", "health"]
+    interval: 30s
+    timeout: 5s
+    startPeriod: 1m
+    retries: 3
 go:
     version: "1.12"
 `)
@@ -38,8 +59,25 @@ go:
 	require.Equal(t, []string{"entrypoint"}, cfg.Entrypoint)
 	require.Equal(t, []string{"command"}, cfg.Command)
 	require.Equal(t, "somebody", cfg.User)
+	require.Equal(t, map[string]string{"NAME": "value", "PORT": "8080"}, cfg.Env)
+	require.Equal(t, []string{"8080", "53/udp"}, cfg.Ports)
+	require.Equal(t, map[string]struct{}{
+		"8080/tcp": {},
+		"53/udp":   {},
+	}, cfg.ExposedPorts())
+	require.Equal(t, []string{"/data"}, cfg.Volumes)
+	require.Equal(t, "/data", cfg.WorkDir)
+	require.Equal(t, "SIGINT", cfg.StopSignal)
+	require.Equal(t, map[string]string{"app": "hello"}, cfg.Labels)
+	require.Equal(t, &Healthcheck{
+		Test:        HealthcheckTest{"CMD", "hello", "health"},
+		Interval:    30 * time.Second,
+		Timeout:     5 * time.Second,
+		StartPeriod: time.Minute,
+		Retries:     3,
+	}, cfg.Healthcheck)
 	require.Equal(t, map[string]interface{}{
-		"go": map[interface{}]interface{}{
+		"go": map[string]interface{}{
 			"version": "1.12",
 		},
 	}, cfg.Other)
@@ -56,6 +94,22 @@ func TestReadConfig_InvalidYAML(t *testing.T) {
 	require.Error(t, err)
 }
 
+func TestReadConfig_MalformedYAML(t *testing.T) {
+	// Arrange
+	inputs := []string{
+		"#\n-\n{",
+		"0: [:!00 \xef",
+	}
+
+	for _, input := range inputs {
+		// Act
+		_, err := Read([]byte(input))
+
+		// Assert
+		require.Error(t, err, "input %q", input)
+	}
+}
+
 func TestReadConfig_InvalidTypes(t *testing.T) {
 	// Arrange
 	data := []byte("debug: nope")
@@ -66,3 +120,351 @@ func TestReadConfig_InvalidTypes(t *testing.T) {
 	// Assert
 	require.Error(t, err)
 }
+
+func TestReadConfig_InvalidValues(t *testing.T) {
+	cases := map[string]string{
+		"port":     `ports: ["http"]`,
+		"range":    `ports: ["65536"]`,
+		"protocol": `ports: ["8080/http"]`,
+		"volume":   `volumes: ["data"]`,
+		"workdir":  `workdir: data`,
+		"signal":   `stopSignal: "kill -9"`,
+		"test":     `healthcheck: {interval: 5s}`,
+		"cmd":      `healthcheck: {test: ["CMD"]}`,
+		"duration": `healthcheck: {test: "true", interval: 5 seconds}`,
+		"retries":  `healthcheck: {test: "true", retries: -1}`,
+	}
+	for name, data := range cases {
+		t.Run(name, func(t *testing.T) {
+			// Act
+			_, err := Read([]byte(data))
+
+			// Assert
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestReadConfig_HealthcheckForms(t *testing.T) {
+	cases := map[string]struct {
+		data     string
+		expected HealthcheckTest
+	}{
+		"shell": {
+			data:     `healthcheck: {test: "wget -q localhost"}`,
+			expected: HealthcheckTest{"CMD-SHELL", "wget -q localhost"},
+		},
+		"exec": {
+			data:     `healthcheck: {test: ["hello", "health"]}`,
+			expected: HealthcheckTest{"CMD", "hello", "health"},
+		},
+		"explicit": {
+			data:     `healthcheck: {test: ["CMD-SHELL", "wget -q localhost"]}`,
+			expected: HealthcheckTest{"CMD-SHELL", "wget -q localhost"},
+		},
+		"none": {
+			data:     `healthcheck: {test: ["NONE"]}`,
+			expected: HealthcheckTest{"NONE"},
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			// Act
+			cfg, err := Read([]byte(c.data))
+
+			// Assert
+			require.Nil(t, err)
+			require.Equal(t, c.expected, cfg.Healthcheck.Test)
+		})
+	}
+}
+
+func TestReadConfig_Empty(t *testing.T) {
+	// Act
+	cfg, err := Read([]byte(""))
+
+	// Assert
+	require.Nil(t, err)
+	require.Equal(t, New().User, cfg.User)
+}
+
+func TestReadConfig_StrictUnknownKey(t *testing.T) {
+	// Arrange
+	data := []byte(`
+debug: false
+usr: somebody
+healthcheck:
+  test: "true"
+  intervall: 5s
+`)
+
+	// Act
+	_, err := Read(data)
+
+	// Assert
+	require.Error(t, err)
+	errs, ok := err.(Errors)
+	require.True(t, ok)
+	require.Len(t, errs, 2)
+	require.Equal(t, "pack.yaml", errs[0].Filename)
+	require.Equal(t, "usr", errs[0].Path)
+	require.Equal(t, 3, errs[0].Line)
+	require.Equal(t, 1, errs[0].Column)
+	require.Equal(t, "unknown key", errs[0].Message)
+	require.Equal(t, "healthcheck.intervall", errs[1].Path)
+	require.Equal(t, 6, errs[1].Line)
+	require.Equal(t, 3, errs[1].Column)
+	require.Equal(t, "pack.yaml:3:1: usr: unknown key", errs[0].Error())
+}
+
+func TestReadConfig_StrictWrongType(t *testing.T) {
+	// Arrange
+	data := []byte(`
+ports:
+  - 8080
+  - [53]
+`)
+
+	// Act
+	_, err := Read(data)
+
+	// Assert
+	require.Error(t, err)
+	errs, ok := err.(Errors)
+	require.True(t, ok)
+	require.Len(t, errs, 1)
+	require.Equal(t, "ports.1", errs[0].Path)
+	require.Equal(t, 4, errs[0].Line)
+	require.Equal(t, 5, errs[0].Column)
+}
+
+func TestReadConfig_InvalidValueLocation(t *testing.T) {
+	// Arrange
+	data := []byte(`
+ports:
+  - 8080
+  - 99999
+`)
+
+	// Act
+	_, err := Read(data)
+
+	// Assert
+	require.Error(t, err)
+	errs, ok := err.(Errors)
+	require.True(t, ok)
+	require.Len(t, errs, 1)
+	require.Equal(t, "ports.1", errs[0].Path)
+	require.Equal(t, 4, errs[0].Line)
+	require.Equal(t, 5, errs[0].Column)
+	require.Contains(t, errs[0].Error(), "invalid port")
+}
+
+func TestErrorAt(t *testing.T) {
+	// Arrange
+	cfg, err := Read([]byte(`
+ports:
+  - 8080
+`))
+	require.Nil(t, err)
+
+	// Act
+	err = cfg.ErrorAt("ports.0", "port %s is reserved", "8080")
+
+	// Assert
+	require.Equal(t, "pack.yaml:3:5: ports.0: port 8080 is reserved", err.Error())
+}
+
+func TestReadConfig_Lax(t *testing.T) {
+	// Arrange
+	data := []byte("usr: somebody")
+
+	// Act
+	cfg, err := ReadWithOptions(data, Options{})
+
+	// Assert
+	require.Nil(t, err)
+	require.Equal(t, "somebody", cfg.Other["usr"])
+}
+
+type sectionConfig struct {
+	Version string
+	Tags    []string
+}
+
+func TestSection_Strict(t *testing.T) {
+	// Arrange
+	RegisterSection("section", sectionConfig{})
+	data := []byte(`
+section:
+  version: "1.0"
+  tag: ["hello"]
+`)
+	cfg, err := Read(data)
+	require.Nil(t, err)
+
+	// Act
+	err = cfg.Section("section", &sectionConfig{})
+
+	// Assert
+	require.Error(t, err)
+	require.Equal(t, "pack.yaml:4:3: section.tag: unknown key", err.Error())
+}
+
+func TestSection_Succeeds(t *testing.T) {
+	// Arrange
+	RegisterSection("section", sectionConfig{})
+	data := []byte(`
+section:
+  version: 1
+  tags: ["hello"]
+`)
+	cfg, err := Read(data)
+	require.Nil(t, err)
+	actual := &sectionConfig{}
+
+	// Act
+	err = cfg.Section("section", actual)
+
+	// Assert
+	require.Nil(t, err)
+	require.Equal(t, &sectionConfig{Version: "1", Tags: []string{"hello"}}, actual)
+}
+
+func TestSection_Missing(t *testing.T) {
+	// Arrange
+	actual := &sectionConfig{Version: "1.0"}
+
+	// Act
+	err := New().Section("section", actual)
+
+	// Assert
+	require.Nil(t, err)
+	require.Equal(t, "1.0", actual.Version)
+}
+
+func TestReadConfig_Profile(t *testing.T) {
+	// Arrange
+	RegisterSection("section", sectionConfig{})
+	data := []byte(`
+debug: true
+env:
+  LOG_LEVEL: debug
+  MODE: dev
+section:
+  version: "1.0"
+  tags: ["debug"]
+profiles:
+  prod:
+    debug: false
+    env:
+      MODE: prod
+    section:
+      tags: ["release"]
+`)
+
+	// Act
+	cfg, err := ReadWithOptions(data, Options{Strict: true, Target: "prod"})
+
+	// Assert
+	require.Nil(t, err)
+	require.False(t, cfg.Debug)
+	require.Equal(t, map[string]string{"LOG_LEVEL": "debug", "MODE": "prod"}, cfg.Env)
+	require.NotContains(t, cfg.Other, "profiles")
+	section := &sectionConfig{}
+	require.Nil(t, cfg.Section("section", section))
+	require.Equal(t, &sectionConfig{Version: "1.0", Tags: []string{"release"}}, section)
+}
+
+func TestReadConfig_ProfileCaseInsensitive(t *testing.T) {
+	// Arrange
+	data := []byte(`
+debug: true
+profiles:
+  prod:
+    Debug: false
+`)
+
+	// Act
+	cfg, err := ReadWithOptions(data, Options{Strict: true, Target: "prod"})
+
+	// Assert
+	require.Nil(t, err)
+	require.False(t, cfg.Debug)
+}
+
+func TestReadConfig_ProfileNotSelected(t *testing.T) {
+	// Arrange
+	data := []byte(`
+debug: true
+profiles:
+  prod:
+    debug: false
+`)
+
+	// Act
+	cfg, err := Read(data)
+
+	// Assert
+	require.Nil(t, err)
+	require.True(t, cfg.Debug)
+	require.NotContains(t, cfg.Other, "profiles")
+}
+
+func TestReadConfig_ProfileUnknown(t *testing.T) {
+	// Arrange
+	data := []byte(`
+profiles:
+  prod: {}
+  debug: {}
+`)
+
+	// Act
+	_, err := ReadWithOptions(data, Options{Target: "test"})
+
+	// Assert
+	require.Error(t, err)
+	require.Equal(t, `config: unknown target "test" (available: debug, prod)`, err.Error())
+}
+
+func TestReadConfig_ProfileNoProfiles(t *testing.T) {
+	// Act
+	_, err := ReadWithOptions([]byte("debug: true"), Options{Target: "test"})
+
+	// Assert
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "no profiles defined")
+}
+
+func TestReadConfig_ProfileStrict(t *testing.T) {
+	// Arrange
+	data := []byte(`
+profiles:
+  prod:
+    debug: nope
+`)
+
+	// Act
+	_, err := Read(data)
+
+	// Assert
+	require.Error(t, err)
+	require.Equal(t, `pack.yaml:4:12: profiles.prod.debug: expected a boolean, got "nope"`, err.Error())
+}
+
+func TestReadConfig_ProfileInvalidValue(t *testing.T) {
+	// Arrange
+	data := []byte(`
+workdir: /app
+profiles:
+  prod:
+    workdir: app
+`)
+
+	// Act
+	_, err := ReadWithOptions(data, Options{Filename: "pack.yaml", Target: "prod"})
+
+	// Assert
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "pack.yaml:5:14: workdir:")
+}
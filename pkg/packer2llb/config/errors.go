@@ -0,0 +1,141 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Error describes a problem with a specific value in the configuration.
+type Error struct {
+	// Name of the file that contains the problem.
+	Filename string
+	// Path to the offending value (e.g., healthcheck.retries).
+	Path string
+	// Position of the offending value in the file (1-based, 0 if unknown).
+	Line   int
+	Column int
+	// Description of the problem.
+	Message string
+
+	// Node with the offending value (if known).
+	node *yaml.Node
+}
+
+func (e *Error) Error() string {
+	var b strings.Builder
+	if e.Filename != "" {
+		b.WriteString(e.Filename)
+		b.WriteString(":")
+	}
+	if e.Line > 0 {
+		fmt.Fprintf(&b, "%d:%d:", e.Line, e.Column)
+	}
+	if b.Len() > 0 {
+		b.WriteString(" ")
+	}
+	if e.Path != "" {
+		b.WriteString(e.Path)
+		b.WriteString(": ")
+	}
+	b.WriteString(e.Message)
+	return b.String()
+}
+
+// Errors is a list of problems found in the configuration.
+type Errors []*Error
+
+func (e Errors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "\n")
+}
+
+// Returns the list as an error (nil if the list is empty).
+func (e Errors) err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+// Creates a new problem for the value at the specified path.
+func newError(path string, format string, args ...interface{}) *Error {
+	return &Error{Path: path, Message: fmt.Sprintf(format, args...)}
+}
+
+// Creates a new problem for the value in the specified node.
+func newErrorAt(node *yaml.Node, path string, format string, args ...interface{}) *Error {
+	err := newError(path, format, args...)
+	err.node = node
+	err.Line = node.Line
+	err.Column = node.Column
+	return err
+}
+
+// Joins the path to the value with the key (or index) of the nested value.
+func joinPath(path string, key interface{}) string {
+	var suffix string
+	switch k := key.(type) {
+	case int:
+		suffix = strconv.Itoa(k)
+	default:
+		suffix = fmt.Sprint(k)
+	}
+	if path == "" {
+		return suffix
+	}
+	return path + "." + suffix
+}
+
+// Finds the node at the specified path in the document. Returns the closest
+// parent if the path does not fully exist.
+func lookup(node *yaml.Node, path string) *yaml.Node {
+	if path == "" {
+		return node
+	}
+	for _, part := range strings.Split(path, ".") {
+		node = resolve(node)
+		switch node.Kind {
+		case yaml.MappingNode:
+			var found *yaml.Node
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				if strings.EqualFold(node.Content[i].Value, part) {
+					found = node.Content[i+1]
+					break
+				}
+			}
+			if found == nil {
+				return node
+			}
+			node = found
+		case yaml.SequenceNode:
+			i, err := strconv.Atoi(part)
+			if err != nil || i < 0 || i >= len(node.Content) {
+				return node
+			}
+			node = node.Content[i]
+		default:
+			return node
+		}
+	}
+	return node
+}
+
+// Follows the aliases and unwraps documents to the actual value.
+func resolve(node *yaml.Node) *yaml.Node {
+	for {
+		switch {
+		case node.Kind == yaml.AliasNode && node.Alias != nil:
+			node = node.Alias
+		case node.Kind == yaml.DocumentNode && len(node.Content) > 0:
+			node = node.Content[0]
+		default:
+			return node
+		}
+	}
+}
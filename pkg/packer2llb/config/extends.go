@@ -0,0 +1,138 @@
+package config
+
+import (
+	"context"
+	"path"
+	"strings"
+
+	"github.com/EricHripko/buildkit-fdk/pkg/cib"
+	"github.com/moby/buildkit/frontend/gateway/client"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// Top-level key that references the configuration files to inherit from.
+const keyExtends = "extends"
+
+// Loader reads the file with the specified path from the build context.
+type Loader func(filename string) ([]byte, error)
+
+// ContextLoader returns a loader that reads the files from the build context
+// of the service.
+func ContextLoader(ctx context.Context, svc cib.Service) Loader {
+	return func(filename string) ([]byte, error) {
+		src, err := svc.Src()
+		if err != nil {
+			return nil, err
+		}
+		return src.ReadFile(ctx, client.ReadRequest{Filename: filename})
+	}
+}
+
+// Parses the document and merges it on top of the documents that it
+// extends. Paths in the main document are relative to the root of the build
+// context, while paths in the other documents are relative to their
+// location. Files that are being loaded are tracked in the chain.
+func (c *Config) load(data []byte, filename string, chain []string) (*yaml.Node, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		if len(chain) > 0 {
+			return nil, errors.Wrapf(err, "config: failed to parse %s", filename)
+		}
+		return nil, err
+	}
+	if len(doc.Content) == 0 {
+		return nil, nil
+	}
+	if len(chain) > 0 {
+		c.track(&doc, filename)
+	}
+	if err := interpolateDocument(resolve(&doc), c.opts.BuildArgs).err(); err != nil {
+		return nil, err
+	}
+	root, extends := c.split(resolve(&doc), keyExtends)
+	if extends == nil {
+		return root, nil
+	}
+	paths, err := extendsPaths(extends)
+	if err != nil {
+		return nil, err
+	}
+
+	dir := "."
+	if len(chain) > 0 {
+		dir = path.Dir(filename)
+	}
+	chain = append(chain, filename)
+	var base *yaml.Node
+	for _, p := range paths {
+		target := path.Join(dir, p)
+		if target == ".." || strings.HasPrefix(target, "../") {
+			return nil, errors.Errorf(
+				"config: %s is outside of the build context (extends chain: %s)",
+				p,
+				strings.Join(chain, " -> "),
+			)
+		}
+		if contains(chain, target) {
+			return nil, errors.Errorf(
+				"config: circular extends (%s)",
+				strings.Join(append(chain, target), " -> "),
+			)
+		}
+		if c.opts.Loader == nil {
+			return nil, errors.Errorf("config: cannot read %s (no loader)", target)
+		}
+		data, err := c.opts.Loader(target)
+		if err != nil {
+			return nil, errors.Wrapf(
+				err,
+				"config: failed to read %s (extends chain: %s)",
+				target,
+				strings.Join(chain, " -> "),
+			)
+		}
+		node, err := c.load(data, target, chain)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case node == nil:
+		case base == nil:
+			base = node
+		default:
+			base = c.merge(base, node)
+		}
+	}
+	if base == nil {
+		return root, nil
+	}
+	return c.merge(base, root), nil
+}
+
+// Returns the paths referenced by extends (either a single path or a list).
+func extendsPaths(node *yaml.Node) ([]string, error) {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		return []string{node.Value}, nil
+	case yaml.SequenceNode:
+		paths := make([]string, 0, len(node.Content))
+		for i, item := range node.Content {
+			item = resolve(item)
+			if item.Kind != yaml.ScalarNode {
+				return nil, Errors{newErrorAt(item, joinPath(keyExtends, i), "expected a string")}
+			}
+			paths = append(paths, item.Value)
+		}
+		return paths, nil
+	}
+	return nil, Errors{newErrorAt(node, keyExtends, "expected a string or a list")}
+}
+
+// Remembers the file that every node in the document came from.
+func (c *Config) track(node *yaml.Node, filename string) {
+	c.origins[node] = filename
+	for _, child := range node.Content {
+		c.track(child, filename)
+	}
+}
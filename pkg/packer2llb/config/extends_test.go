@@ -0,0 +1,178 @@
+package config
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Creates a loader that serves the files from memory.
+func memoryLoader(files map[string]string) Loader {
+	return func(filename string) ([]byte, error) {
+		data, ok := files[filename]
+		if !ok {
+			return nil, errors.New("not found")
+		}
+		return []byte(data), nil
+	}
+}
+
+func TestReadConfig_Extends(t *testing.T) {
+	// Arrange
+	RegisterSection("section", sectionConfig{})
+	files := map[string]string{
+		"base.pack.yaml": `
+user: somebody
+debug: false
+ports: ["8080", "8081"]
+env:
+  LOG_LEVEL: info
+  MODE: base
+section:
+  version: "1.0"
+  tags: ["base"]
+`,
+	}
+	data := []byte(`
+extends: base.pack.yaml
+ports: ["9090"]
+env:
+  MODE: service
+section:
+  tags: ["service"]
+`)
+	opts := Options{Strict: true, Loader: memoryLoader(files)}
+
+	// Act
+	cfg, err := ReadWithOptions(data, opts)
+
+	// Assert
+	require.Nil(t, err)
+	require.Equal(t, "somebody", cfg.User)
+	require.False(t, cfg.Debug)
+	require.Equal(t, []string{"9090"}, cfg.Ports)
+	require.Equal(t, map[string]string{"LOG_LEVEL": "info", "MODE": "service"}, cfg.Env)
+	section := &sectionConfig{}
+	require.Nil(t, cfg.Section("section", section))
+	require.Equal(t, &sectionConfig{Version: "1.0", Tags: []string{"service"}}, section)
+}
+
+func TestReadConfig_ExtendsNested(t *testing.T) {
+	// Arrange
+	files := map[string]string{
+		"services/common.pack.yaml": `
+extends: ../base.pack.yaml
+user: somebody
+`,
+		"base.pack.yaml": `
+user: nobody
+workdir: /app
+`,
+		"other.pack.yaml": `
+debug: false
+`,
+	}
+	data := []byte(`
+extends: [services/common.pack.yaml, other.pack.yaml]
+`)
+	opts := Options{Strict: true, Loader: memoryLoader(files)}
+
+	// Act
+	cfg, err := ReadWithOptions(data, opts)
+
+	// Assert
+	require.Nil(t, err)
+	require.Equal(t, "somebody", cfg.User)
+	require.Equal(t, "/app", cfg.WorkDir)
+	require.False(t, cfg.Debug)
+}
+
+func TestReadConfig_ExtendsCycle(t *testing.T) {
+	// Arrange
+	files := map[string]string{
+		"a.yaml":    "extends: b.yaml",
+		"b.yaml":    "extends: pack.yaml",
+		"pack.yaml": "extends: a.yaml",
+	}
+	opts := Options{Filename: "pack.yaml", Loader: memoryLoader(files)}
+
+	// Act
+	_, err := ReadWithOptions([]byte(files["pack.yaml"]), opts)
+
+	// Assert
+	require.Error(t, err)
+	require.Equal(t, "config: circular extends (pack.yaml -> a.yaml -> b.yaml -> pack.yaml)", err.Error())
+}
+
+func TestReadConfig_ExtendsNotFound(t *testing.T) {
+	// Arrange
+	files := map[string]string{
+		"a.yaml": "extends: missing.yaml",
+	}
+	opts := Options{Filename: "pack.yaml", Loader: memoryLoader(files)}
+
+	// Act
+	_, err := ReadWithOptions([]byte("extends: a.yaml"), opts)
+
+	// Assert
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "failed to read missing.yaml (extends chain: pack.yaml -> a.yaml)")
+}
+
+func TestReadConfig_ExtendsOutsideContext(t *testing.T) {
+	// Arrange
+	opts := Options{Filename: "pack.yaml", Loader: memoryLoader(nil)}
+
+	// Act
+	_, err := ReadWithOptions([]byte("extends: ../base.yaml"), opts)
+
+	// Assert
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "outside of the build context")
+}
+
+func TestReadConfig_ExtendsInvalid(t *testing.T) {
+	// Act
+	_, err := Read([]byte("extends: {path: base.yaml}"))
+
+	// Assert
+	require.Error(t, err)
+	require.Equal(t, "pack.yaml:1:10: extends: expected a string or a list", err.Error())
+}
+
+func TestReadConfig_ExtendsErrorLocation(t *testing.T) {
+	// Arrange
+	files := map[string]string{
+		"base.yaml": `
+debug: false
+usr: somebody
+`,
+	}
+	opts := Options{Filename: "pack.yaml", Strict: true, Loader: memoryLoader(files)}
+
+	// Act
+	_, err := ReadWithOptions([]byte("extends: base.yaml"), opts)
+
+	// Assert
+	require.Error(t, err)
+	require.Equal(t, "base.yaml:3:1: usr: unknown key", err.Error())
+}
+
+func TestReadConfig_ExtendsInvalidValueLocation(t *testing.T) {
+	// Arrange
+	files := map[string]string{
+		"base.yaml": `
+debug: false
+workdir: app
+`,
+	}
+	opts := Options{Filename: "pack.yaml", Strict: true, Loader: memoryLoader(files)}
+
+	// Act
+	_, err := ReadWithOptions([]byte("extends: base.yaml"), opts)
+
+	// Assert
+	require.Error(t, err)
+	require.Equal(t, `base.yaml:3:10: workdir: "app" must be an absolute path`, err.Error())
+}
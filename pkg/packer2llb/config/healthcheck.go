@@ -0,0 +1,105 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// Healthcheck describes how to check that the container is healthy.
+type Healthcheck struct {
+	// Command to run to check the health of the container.
+	Test HealthcheckTest
+	// Time to wait between checks.
+	Interval time.Duration
+	// Time to wait before considering the check to have hung.
+	Timeout time.Duration
+	// Time for the container to initialise before the retries start to
+	// count down.
+	StartPeriod time.Duration
+	// Number of consecutive failures needed to consider the container
+	// unhealthy.
+	Retries int
+}
+
+// HealthcheckTest is the command used by the health check in the image
+// config format (e.g., ["CMD", "app", "health"] or ["CMD-SHELL", "app"]).
+type HealthcheckTest []string
+
+// Healthcheck test kinds.
+const (
+	// HealthcheckNone disables the health check.
+	HealthcheckNone = "NONE"
+	// HealthcheckCmd executes the command directly.
+	HealthcheckCmd = "CMD"
+	// HealthcheckShell runs the command with the shell.
+	HealthcheckShell = "CMD-SHELL"
+)
+
+// IsShell returns true if the command is run with the shell.
+func (t HealthcheckTest) IsShell() bool {
+	return len(t) > 0 && t[0] == HealthcheckShell
+}
+
+// Binary returns the executable run by the exec form of the command (empty
+// otherwise).
+func (t HealthcheckTest) Binary() string {
+	if len(t) > 1 && t[0] == HealthcheckCmd {
+		return t[1]
+	}
+	return ""
+}
+
+// Validates that the health check is well-formed.
+func (h *Healthcheck) validate(path string) (errs Errors) {
+	switch {
+	case len(h.Test) == 0:
+		errs = append(errs, newError(path, "test is required"))
+	case h.Test[0] != HealthcheckNone && len(h.Test) < 2:
+		errs = append(errs, newError(joinPath(path, "test"), "no command specified"))
+	}
+	durations := []struct {
+		key   string
+		value time.Duration
+	}{
+		{"interval", h.Interval},
+		{"timeout", h.Timeout},
+		{"startPeriod", h.StartPeriod},
+	}
+	for _, duration := range durations {
+		if duration.value < 0 {
+			errs = append(errs, newError(joinPath(path, duration.key), "must not be negative"))
+		}
+	}
+	if h.Retries < 0 {
+		errs = append(errs, newError(joinPath(path, "retries"), "must not be negative"))
+	}
+	return
+}
+
+// Converts the command from the compose-like format used in pack.yaml to the
+// image config format. A string is run with the shell, while a list is
+// executed directly unless it's already prefixed with the kind.
+func stringToHealthcheckTest(from reflect.Type, to reflect.Type, data interface{}) (interface{}, error) {
+	if to != reflect.TypeOf(HealthcheckTest{}) {
+		return data, nil
+	}
+	switch from.Kind() {
+	case reflect.String:
+		return HealthcheckTest{HealthcheckShell, data.(string)}, nil
+	case reflect.Slice:
+		value := reflect.ValueOf(data)
+		test := make(HealthcheckTest, value.Len())
+		for i := range test {
+			test[i] = fmt.Sprint(value.Index(i).Interface())
+		}
+		if len(test) > 0 {
+			switch test[0] {
+			case HealthcheckNone, HealthcheckCmd, HealthcheckShell:
+				return test, nil
+			}
+		}
+		return append(HealthcheckTest{HealthcheckCmd}, test...), nil
+	}
+	return data, nil
+}
@@ -0,0 +1,173 @@
+package config
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// Substitutes the variables (e.g., ${VERSION:-1.16}) in all the values of the
+// document. Plain values are re-typed after the substitution, so that
+// variables can be used for booleans and numbers too.
+func interpolate(node *yaml.Node, vars map[string]string, path string) (errs Errors) {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, child := range node.Content {
+			errs = append(errs, interpolate(child, vars, path)...)
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			errs = append(errs, interpolate(value, vars, joinPath(path, key.Value))...)
+		}
+	case yaml.SequenceNode:
+		for i, item := range node.Content {
+			errs = append(errs, interpolate(item, vars, joinPath(path, i))...)
+		}
+	case yaml.ScalarNode:
+		if !strings.Contains(node.Value, "$") {
+			return nil
+		}
+		value, err := expand(node.Value, vars)
+		if err != nil {
+			return Errors{newErrorAt(node, path, "%s", err)}
+		}
+		node.Value = value
+		if node.Style == 0 {
+			node.Tag = ""
+		}
+	}
+	return
+}
+
+// Substitutes the variables in the document apart from the profiles, which
+// are substituted once the target is known (see interpolateProfiles).
+func interpolateDocument(root *yaml.Node, vars map[string]string) Errors {
+	if root.Kind != yaml.MappingNode {
+		return interpolate(root, vars, "")
+	}
+	var errs Errors
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		key, value := root.Content[i], root.Content[i+1]
+		if key.Value == keyProfiles {
+			continue
+		}
+		errs = append(errs, interpolate(value, vars, key.Value)...)
+	}
+	return errs
+}
+
+// Substitutes the variables in the profiles. Only the errors of the selected
+// profile are reported, so that the variables required by the other profiles
+// (e.g., ${PROD_USER:?must be set}) don't have to be set.
+func interpolateProfiles(profiles *yaml.Node, vars map[string]string, target string) Errors {
+	if profiles == nil || profiles.Kind != yaml.MappingNode {
+		return nil
+	}
+	var errs Errors
+	for i := 0; i+1 < len(profiles.Content); i += 2 {
+		name, profile := profiles.Content[i], profiles.Content[i+1]
+		profileErrs := interpolate(profile, vars, joinPath(keyProfiles, name.Value))
+		if name.Value == target {
+			errs = append(errs, profileErrs...)
+		}
+	}
+	return errs
+}
+
+// Expands the variables in the string using shell-like syntax:
+//
+//	$VAR or ${VAR}      value of the variable (empty if unset)
+//	${VAR:-default}     default if the variable is unset or empty
+//	${VAR-default}      default if the variable is unset
+//	${VAR:?message}     error if the variable is unset or empty
+//	${VAR?message}      error if the variable is unset
+//	$$                  literal $
+func expand(s string, vars map[string]string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '$' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+
+		next := s[i+1]
+		switch {
+		case next == '$':
+			b.WriteByte('$')
+			i++
+		case next == '{':
+			end := strings.IndexByte(s[i+2:], '}')
+			if end < 0 {
+				return "", errors.Errorf("missing '}' in %q", s)
+			}
+			value, err := substitute(s[i+2:i+2+end], vars)
+			if err != nil {
+				return "", err
+			}
+			b.WriteString(value)
+			i += 2 + end
+		case isNameStart(next):
+			end := i + 1
+			for end < len(s) && isName(s[end]) {
+				end++
+			}
+			b.WriteString(vars[s[i+1:end]])
+			i = end - 1
+		default:
+			b.WriteByte('$')
+		}
+	}
+	return b.String(), nil
+}
+
+// Evaluates the expression inside of ${...}.
+func substitute(expr string, vars map[string]string) (string, error) {
+	end := 0
+	for end < len(expr) && isName(expr[end]) {
+		end++
+	}
+	name, modifier := expr[:end], expr[end:]
+	if name == "" || !isNameStart(name[0]) {
+		return "", errors.Errorf("invalid variable name in ${%s}", expr)
+	}
+	value, set := vars[name]
+	if modifier == "" {
+		return value, nil
+	}
+
+	// Whether empty values should be treated as unset
+	if strings.HasPrefix(modifier, ":") {
+		modifier = modifier[1:]
+		set = set && value != ""
+	}
+	if modifier == "" {
+		return "", errors.Errorf("invalid modifier in ${%s}", expr)
+	}
+	word := modifier[1:]
+	switch modifier[0] {
+	case '-':
+		if !set {
+			return word, nil
+		}
+		return value, nil
+	case '?':
+		if !set {
+			if word == "" {
+				word = "required variable is not set"
+			}
+			return "", errors.Errorf("%s: %s", name, word)
+		}
+		return value, nil
+	}
+	return "", errors.Errorf("invalid modifier in ${%s}", expr)
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isName(c byte) bool {
+	return isNameStart(c) || (c >= '0' && c <= '9')
+}
@@ -0,0 +1,153 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpand(t *testing.T) {
+	vars := map[string]string{
+		"SET":   "value",
+		"EMPTY": "",
+	}
+	cases := map[string]struct {
+		input    string
+		expected string
+	}{
+		"literal":        {"value", "value"},
+		"simple":         {"$SET", "value"},
+		"braces":         {"${SET}", "value"},
+		"embedded":       {"a-${SET}-b", "a-value-b"},
+		"suffix":         {"$SET.txt", "value.txt"},
+		"unset":          {"${UNSET}", ""},
+		"escaped":        {"$$SET", "$SET"},
+		"trailing":       {"cost: 5$", "cost: 5$"},
+		"not a name":     {"$1", "$1"},
+		"default unset":  {"${UNSET:-default}", "default"},
+		"default empty":  {"${EMPTY:-default}", "default"},
+		"default set":    {"${SET:-default}", "value"},
+		"fallback unset": {"${UNSET-default}", "default"},
+		"fallback empty": {"${EMPTY-default}", ""},
+		"required set":   {"${SET:?missing}", "value"},
+		"required empty": {"${EMPTY?missing}", ""},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			// Act
+			actual, err := expand(c.input, vars)
+
+			// Assert
+			require.Nil(t, err)
+			require.Equal(t, c.expected, actual)
+		})
+	}
+}
+
+func TestExpand_Fails(t *testing.T) {
+	vars := map[string]string{"EMPTY": ""}
+	cases := map[string]struct {
+		input   string
+		message string
+	}{
+		"unterminated":   {"${UNSET", "missing '}'"},
+		"invalid name":   {"${1}", "invalid variable name"},
+		"empty name":     {"${}", "invalid variable name"},
+		"bad modifier":   {"${UNSET:+value}", "invalid modifier"},
+		"required unset": {"${UNSET?}", "UNSET: required variable is not set"},
+		"required empty": {"${EMPTY:?must be set}", "EMPTY: must be set"},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			// Act
+			_, err := expand(c.input, vars)
+
+			// Assert
+			require.Error(t, err)
+			require.Contains(t, err.Error(), c.message)
+		})
+	}
+}
+
+func TestReadConfig_Interpolate(t *testing.T) {
+	// Arrange
+	RegisterSection("section", sectionConfig{})
+	data := []byte(`
+debug: ${DEBUG:-false}
+user: "${USER}"
+env:
+  VERSION: ${VERSION}
+  PATH: /app:$$PATH
+section:
+  version: ${GO_VERSION:-1.20}
+  tags: ["${TAGS}"]
+`)
+	args := map[string]string{
+		"USER":    "true",
+		"VERSION": "1.0.0",
+		"TAGS":    "netgo",
+	}
+
+	// Act
+	cfg, err := ReadWithOptions(data, Options{Strict: true, BuildArgs: args})
+
+	// Assert
+	require.Nil(t, err)
+	require.False(t, cfg.Debug)
+	require.Equal(t, "true", cfg.User)
+	require.Equal(t, map[string]string{
+		"VERSION": "1.0.0",
+		"PATH":    "/app:$PATH",
+	}, cfg.Env)
+	section := &sectionConfig{}
+	require.Nil(t, cfg.Section("section", section))
+	require.Equal(t, &sectionConfig{Version: "1.20", Tags: []string{"netgo"}}, section)
+}
+
+func TestReadConfig_InterpolateRequired(t *testing.T) {
+	// Arrange
+	data := []byte(`
+env:
+  TOKEN: ${TOKEN:?token must be provided}
+`)
+
+	// Act
+	_, err := Read(data)
+
+	// Assert
+	require.Error(t, err)
+	require.Equal(t, "pack.yaml:3:10: env.TOKEN: TOKEN: token must be provided", err.Error())
+}
+
+func TestReadConfig_InterpolateRequiredProfile(t *testing.T) {
+	// Arrange
+	data := []byte(`
+user: somebody
+profiles:
+  prod:
+    user: ${PROD_USER:?must be set}
+`)
+
+	// Act
+	cfg, err := ReadWithOptions(data, Options{Filename: "pack.yaml", Strict: true})
+	_, prodErr := ReadWithOptions(data, Options{Filename: "pack.yaml", Strict: true, Target: "prod"})
+
+	// Assert
+	require.Nil(t, err)
+	require.Equal(t, "somebody", cfg.User)
+	require.Error(t, prodErr)
+	require.Equal(t, "pack.yaml:5:11: profiles.prod.user: PROD_USER: must be set", prodErr.Error())
+}
+
+func TestReadConfig_InterpolateWrongType(t *testing.T) {
+	// Arrange
+	data := []byte("debug: ${DEBUG}")
+	args := map[string]string{"DEBUG": "nope"}
+
+	// Act
+	_, err := ReadWithOptions(data, Options{Strict: true, BuildArgs: args})
+
+	// Assert
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "expected a boolean")
+}
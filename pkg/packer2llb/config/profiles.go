@@ -0,0 +1,110 @@
+package config
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// Top-level key that holds the named profiles.
+const keyProfiles = "profiles"
+
+// Separates the value of the top-level key from the rest of the document.
+func (c *Config) split(root *yaml.Node, key string) (*yaml.Node, *yaml.Node) {
+	if root.Kind != yaml.MappingNode {
+		return root, nil
+	}
+	rest := *root
+	rest.Content = make([]*yaml.Node, 0, len(root.Content))
+	if file, ok := c.origins[root]; ok {
+		c.origins[&rest] = file
+	}
+	var value *yaml.Node
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value == key {
+			value = resolve(root.Content[i+1])
+			continue
+		}
+		rest.Content = append(rest.Content, root.Content[i], root.Content[i+1])
+	}
+	return &rest, value
+}
+
+// Checks that every profile is a valid (partial) configuration.
+func checkProfiles(profiles *yaml.Node) Errors {
+	if profiles == nil {
+		return nil
+	}
+	if profiles.Kind != yaml.MappingNode {
+		return Errors{newErrorAt(profiles, keyProfiles, "expected a mapping")}
+	}
+	var errs Errors
+	for i := 0; i+1 < len(profiles.Content); i += 2 {
+		name, profile := profiles.Content[i], profiles.Content[i+1]
+		path := joinPath(keyProfiles, name.Value)
+		errs = append(errs, check(profile, reflect.TypeOf(Config{}), path)...)
+	}
+	return errs
+}
+
+// Applies the selected profile on top of the document.
+func (c *Config) applyProfile(root *yaml.Node, profiles *yaml.Node, target string) (*yaml.Node, error) {
+	if target == "" {
+		return root, nil
+	}
+	var names []string
+	if profiles != nil && profiles.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(profiles.Content); i += 2 {
+			name, profile := profiles.Content[i], profiles.Content[i+1]
+			if name.Value == target {
+				return c.merge(root, profile), nil
+			}
+			names = append(names, name.Value)
+		}
+	}
+	if len(names) == 0 {
+		return nil, errors.Errorf("config: unknown target %q (no profiles defined)", target)
+	}
+	sort.Strings(names)
+	return nil, errors.Errorf(
+		"config: unknown target %q (available: %s)",
+		target,
+		strings.Join(names, ", "),
+	)
+}
+
+// Merges the override into the base document. Mappings are merged
+// recursively, while all other values are replaced. Keys are compared
+// case-insensitively, the same way the settings are decoded.
+func (c *Config) merge(base *yaml.Node, override *yaml.Node) *yaml.Node {
+	base = resolve(base)
+	override = resolve(override)
+	if base.Kind != yaml.MappingNode || override.Kind != yaml.MappingNode {
+		return override
+	}
+
+	merged := *base
+	merged.Content = make([]*yaml.Node, len(base.Content))
+	copy(merged.Content, base.Content)
+	if file, ok := c.origins[base]; ok {
+		c.origins[&merged] = file
+	}
+	for i := 0; i+1 < len(override.Content); i += 2 {
+		key, value := override.Content[i], override.Content[i+1]
+		found := false
+		for j := 0; j+1 < len(merged.Content); j += 2 {
+			if strings.EqualFold(merged.Content[j].Value, key.Value) {
+				merged.Content[j+1] = c.merge(merged.Content[j+1], value)
+				found = true
+				break
+			}
+		}
+		if !found {
+			merged.Content = append(merged.Content, key, value)
+		}
+	}
+	return &merged
+}
@@ -0,0 +1,150 @@
+package config
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Schema is the subset of JSON Schema used to describe pack.yaml.
+type Schema struct {
+	// Version of JSON Schema used (set at the root only).
+	Schema string `json:"$schema,omitempty"`
+	// Title of the schema (set at the root only).
+	Title string `json:"title,omitempty"`
+	// Type of the value.
+	Type string `json:"type,omitempty"`
+	// Alternative schemas for the value.
+	OneOf []*Schema `json:"oneOf,omitempty"`
+	// Fixed set of values accepted.
+	Enum []string `json:"enum,omitempty"`
+	// Regular expression that the value must match.
+	Pattern string `json:"pattern,omitempty"`
+	// Schema for the items of an array.
+	Items *Schema `json:"items,omitempty"`
+	// Schemas for the known properties of an object.
+	Properties map[string]*Schema `json:"properties,omitempty"`
+	// Whether unknown properties are allowed (or the schema they must
+	// satisfy).
+	AdditionalProperties interface{} `json:"additionalProperties,omitempty"`
+}
+
+// Enum is implemented by types that only accept a fixed set of values.
+type Enum interface {
+	// Values returns the accepted values.
+	Values() []string
+}
+
+var enumType = reflect.TypeOf((*Enum)(nil)).Elem()
+
+// NewSchema generates the JSON Schema for pack.yaml from the configuration
+// structure and the sections registered by plugins.
+func NewSchema() *Schema {
+	schema := schemaFor(reflect.TypeOf(Config{}))
+
+	keys := make([]string, 0, len(sections))
+	for key := range sections {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if prototype := sections[key]; prototype != nil {
+			schema.Properties[key] = schemaFor(reflect.TypeOf(prototype))
+		} else {
+			schema.Properties[key] = &Schema{}
+		}
+	}
+
+	// Profiles override any of the settings above
+	profile := *schema
+	profile.Properties = make(map[string]*Schema, len(schema.Properties))
+	for key, property := range schema.Properties {
+		profile.Properties[key] = property
+	}
+	schema.Properties[keyProfiles] = &Schema{
+		Type:                 "object",
+		AdditionalProperties: &profile,
+	}
+	schema.Properties[keyExtends] = &Schema{OneOf: []*Schema{
+		{Type: "string"},
+		{Type: "array", Items: &Schema{Type: "string"}},
+	}}
+	schema.Schema = "http://json-schema.org/draft-07/schema#"
+	schema.Title = "pack.yaml"
+	return schema
+}
+
+// Generates the schema for the values of the provided type.
+func schemaFor(t reflect.Type) *Schema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	// Special types
+	switch {
+	case t == durationType:
+		return &Schema{OneOf: []*Schema{
+			{Type: "string", Pattern: `^([0-9]+(\.[0-9]+)?(ns|us|µs|ms|s|m|h))+$`},
+			{Type: "integer"},
+		}}
+	case t == healthcheckTestType:
+		return &Schema{OneOf: []*Schema{
+			{Type: "string"},
+			{Type: "array", Items: &Schema{Type: "string"}},
+		}}
+	case t.Implements(enumType):
+		values := reflect.Zero(t).Interface().(Enum).Values()
+		return &Schema{Type: "string", Enum: values}
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		schema := &Schema{
+			Type:                 "object",
+			Properties:           make(map[string]*Schema),
+			AdditionalProperties: false,
+		}
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if field.PkgPath != "" {
+				continue
+			}
+			name := fieldName(field)
+			if name == "" {
+				continue
+			}
+			schema.Properties[name] = schemaFor(field.Type)
+		}
+		return schema
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: schemaFor(t.Elem())}
+	case reflect.Slice, reflect.Array:
+		return &Schema{Type: "array", Items: schemaFor(t.Elem())}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	}
+	return &Schema{}
+}
+
+// Returns the key used for the field in pack.yaml (empty if the field is not
+// decoded directly).
+func fieldName(field reflect.StructField) string {
+	tag := strings.Split(field.Tag.Get("mapstructure"), ",")
+	if tag[0] == "-" || contains(tag[1:], "remain") {
+		return ""
+	}
+	if tag[0] != "" {
+		return tag[0]
+	}
+	runes := []rune(field.Name)
+	runes[0] = unicode.ToLower(runes[0])
+	return string(runes)
+}
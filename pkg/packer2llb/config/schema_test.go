@@ -0,0 +1,79 @@
+package config
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type schemaMode string
+
+func (schemaMode) Values() []string {
+	return []string{"fast", "slow"}
+}
+
+type schemaConfig struct {
+	Mode    schemaMode
+	Tags    []string
+	Ignored string `mapstructure:"-"`
+}
+
+func TestNewSchema(t *testing.T) {
+	// Arrange
+	RegisterSection("schema", schemaConfig{})
+
+	// Act
+	schema := NewSchema()
+
+	// Assert
+	require.Equal(t, "http://json-schema.org/draft-07/schema#", schema.Schema)
+	require.Equal(t, "object", schema.Type)
+	require.Equal(t, false, schema.AdditionalProperties)
+	require.Equal(t, &Schema{Type: "boolean"}, schema.Properties["debug"])
+	require.Equal(t, &Schema{
+		Type:  "array",
+		Items: &Schema{Type: "string"},
+	}, schema.Properties["entrypoint"])
+	require.Equal(t, &Schema{
+		Type:                 "object",
+		AdditionalProperties: &Schema{Type: "string"},
+	}, schema.Properties["env"])
+	require.Contains(t, schema.Properties, "workdir")
+	require.Contains(t, schema.Properties, "stopSignal")
+	require.NotContains(t, schema.Properties, "other")
+
+	profiles := schema.Properties["profiles"]
+	require.Equal(t, "object", profiles.Type)
+	profile := profiles.AdditionalProperties.(*Schema)
+	require.Contains(t, profile.Properties, "debug")
+	require.NotContains(t, profile.Properties, "profiles")
+	require.NotContains(t, profile.Properties, "extends")
+	require.Len(t, schema.Properties["extends"].OneOf, 2)
+	require.Empty(t, profile.Schema)
+
+	healthcheck := schema.Properties["healthcheck"]
+	require.Equal(t, "object", healthcheck.Type)
+	require.Len(t, healthcheck.Properties["test"].OneOf, 2)
+	require.Len(t, healthcheck.Properties["startPeriod"].OneOf, 2)
+	require.Equal(t, &Schema{Type: "integer"}, healthcheck.Properties["retries"])
+
+	require.Equal(t, &Schema{
+		Type: "object",
+		Properties: map[string]*Schema{
+			"mode": {Type: "string", Enum: []string{"fast", "slow"}},
+			"tags": {Type: "array", Items: &Schema{Type: "string"}},
+		},
+		AdditionalProperties: false,
+	}, schema.Properties["schema"])
+}
+
+func TestNewSchema_Marshal(t *testing.T) {
+	// Act
+	data, err := json.Marshal(NewSchema())
+
+	// Assert
+	require.Nil(t, err)
+	require.Contains(t, string(data), `"$schema":"http://json-schema.org/draft-07/schema#"`)
+	require.Contains(t, string(data), `"additionalProperties":false`)
+}
@@ -0,0 +1,153 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Top-level keys that hold the configuration of plugins along with the
+// prototype of the configuration structure.
+var sections = make(map[string]interface{})
+
+// RegisterSection marks the top-level key as a configuration section owned
+// by a plugin, so that it's not reported as unknown in strict mode and is
+// included in the schema.
+func RegisterSection(key string, prototype interface{}) {
+	sections[key] = prototype
+}
+
+var (
+	durationType        = reflect.TypeOf(time.Duration(0))
+	healthcheckTestType = reflect.TypeOf(HealthcheckTest{})
+)
+
+// Checks that the document matches the structure of the provided type and
+// reports unknown keys as well as values of wrong type.
+//nolint:gocyclo // Mirrors the type system
+func check(node *yaml.Node, t reflect.Type, path string) (errs Errors) {
+	node = resolve(node)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	// Empty values leave the defaults intact
+	if node.Kind == yaml.ScalarNode && node.ShortTag() == "!!null" {
+		return nil
+	}
+	fail := func(format string, args ...interface{}) Errors {
+		return Errors{newErrorAt(node, path, format, args...)}
+	}
+
+	// Special types
+	switch t {
+	case durationType:
+		if node.Kind != yaml.ScalarNode {
+			return fail("expected a duration")
+		}
+		switch node.ShortTag() {
+		case "!!int":
+			return nil
+		case "!!str":
+			if _, err := time.ParseDuration(node.Value); err != nil {
+				return fail("invalid duration %q", node.Value)
+			}
+			return nil
+		}
+		return fail("expected a duration, got %q", node.Value)
+	case healthcheckTestType:
+		// Shell form
+		if node.Kind == yaml.ScalarNode {
+			return nil
+		}
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		if node.Kind != yaml.MappingNode {
+			return fail("expected a mapping")
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			keyPath := joinPath(path, key.Value)
+			if field, ok := findField(t, key.Value); ok {
+				errs = append(errs, check(value, field.Type, keyPath)...)
+				continue
+			}
+			if _, ok := sections[key.Value]; ok && hasRemain(t) {
+				continue
+			}
+			errs = append(errs, newErrorAt(key, keyPath, "unknown key"))
+		}
+	case reflect.Map:
+		if node.Kind != yaml.MappingNode {
+			return fail("expected a mapping")
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			errs = append(errs, check(value, t.Elem(), joinPath(path, key.Value))...)
+		}
+	case reflect.Slice:
+		if node.Kind != yaml.SequenceNode {
+			return fail("expected a list")
+		}
+		for i, item := range node.Content {
+			errs = append(errs, check(item, t.Elem(), joinPath(path, i))...)
+		}
+	case reflect.String:
+		if node.Kind != yaml.ScalarNode {
+			return fail("expected a string")
+		}
+	case reflect.Bool:
+		if node.Kind != yaml.ScalarNode || node.ShortTag() != "!!bool" {
+			return fail("expected a boolean, got %q", node.Value)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if node.Kind != yaml.ScalarNode || node.ShortTag() != "!!int" {
+			return fail("expected an integer, got %q", node.Value)
+		}
+	case reflect.Float32, reflect.Float64:
+		if node.Kind != yaml.ScalarNode || (node.ShortTag() != "!!int" && node.ShortTag() != "!!float") {
+			return fail("expected a number, got %q", node.Value)
+		}
+	}
+	return
+}
+
+// Finds the field that the key is decoded into (matched case-insensitively
+// like mapstructure does).
+func findField(t reflect.Type, key string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		name := fieldName(field)
+		if name != "" && strings.EqualFold(name, key) {
+			return field, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// Returns true if the struct collects the keys that do not match any field.
+func hasRemain(t reflect.Type) bool {
+	for i := 0; i < t.NumField(); i++ {
+		tag := strings.Split(t.Field(i).Tag.Get("mapstructure"), ",")
+		if contains(tag[1:], "remain") {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
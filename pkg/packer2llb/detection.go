@@ -0,0 +1,52 @@
+package packer2llb
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/EricHripko/pack.yaml/pkg/packer2llb/config"
+)
+
+// Confidence levels for the detection of a project.
+const (
+	// ConfidenceLow is used when the project merely contains files of the
+	// ecosystem (e.g., source files).
+	ConfidenceLow = 25
+	// ConfidenceMedium is used when the project is likely to belong to the
+	// ecosystem, but lacks the metadata.
+	ConfidenceMedium = 50
+	// ConfidenceHigh is used when the project metadata of the ecosystem is
+	// present (e.g., go.mod).
+	ConfidenceHigh = 100
+)
+
+// Detection describes a project detected by a plugin. It is created for
+// every build, so that the plugins themselves remain stateless.
+type Detection struct {
+	// Name of the plugin that detected the project.
+	Plugin string
+	// Confidence of the detection (from 0 to 100).
+	Confidence int
+	// Name of the project (e.g., Go module path).
+	Project string
+	// Version of the language or toolchain the project targets (e.g., 1.16).
+	Version string
+	// Reasons that the project was detected (e.g., found go.mod).
+	Reasons []string
+	// Names of the binaries that the build installs into DirInstall (if
+	// known).
+	Binaries []string
+	// General configuration supplied by the user.
+	Config *config.Config
+	// Plugin-specific state (e.g., configuration of the plugin).
+	Data interface{}
+}
+
+// String describes the detection in a human-readable format.
+func (d *Detection) String() string {
+	s := fmt.Sprintf("%s with confidence %d", d.Plugin, d.Confidence)
+	if len(d.Reasons) > 0 {
+		s += ": " + strings.Join(d.Reasons, ", ")
+	}
+	return s
+}
@@ -0,0 +1,6 @@
+package packer2llb
+
+// Plugins returns the registered plugins (for testing).
+func Plugins() []Plugin {
+	return plugins
+}
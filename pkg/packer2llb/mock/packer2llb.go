@@ -7,6 +7,7 @@ package packer2llb_mock
 import (
 	context "context"
 	cib "github.com/EricHripko/buildkit-fdk/pkg/cib"
+	packer2llb "github.com/EricHripko/pack.yaml/pkg/packer2llb"
 	config "github.com/EricHripko/pack.yaml/pkg/packer2llb/config"
 	gomock "github.com/golang/mock/gomock"
 	llb "github.com/moby/buildkit/client/llb"
@@ -40,9 +41,9 @@ func (m *MockPlugin) EXPECT() *MockPluginMockRecorder {
 }
 
 // Build mocks base method
-func (m *MockPlugin) Build(arg0 context.Context, arg1 *v1.Platform, arg2 cib.Service) (*llb.State, *dockerfile2llb.Image, error) {
+func (m *MockPlugin) Build(arg0 context.Context, arg1 *v1.Platform, arg2 cib.Service, arg3 *packer2llb.Detection) (*llb.State, *dockerfile2llb.Image, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Build", arg0, arg1, arg2)
+	ret := m.ctrl.Call(m, "Build", arg0, arg1, arg2, arg3)
 	ret0, _ := ret[0].(*llb.State)
 	ret1, _ := ret[1].(*dockerfile2llb.Image)
 	ret2, _ := ret[2].(error)
@@ -50,17 +51,33 @@ func (m *MockPlugin) Build(arg0 context.Context, arg1 *v1.Platform, arg2 cib.Ser
 }
 
 // Build indicates an expected call of Build
-func (mr *MockPluginMockRecorder) Build(arg0, arg1, arg2 interface{}) *gomock.Call {
+func (mr *MockPluginMockRecorder) Build(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Build", reflect.TypeOf((*MockPlugin)(nil).Build), arg0, arg1, arg2)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Build", reflect.TypeOf((*MockPlugin)(nil).Build), arg0, arg1, arg2, arg3)
+}
+
+// BuildArtifacts mocks base method
+func (m *MockPlugin) BuildArtifacts(arg0 context.Context, arg1 *v1.Platform, arg2 cib.Service, arg3 *packer2llb.Detection) (*llb.State, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "BuildArtifacts", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(*llb.State)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// BuildArtifacts indicates an expected call of BuildArtifacts
+func (mr *MockPluginMockRecorder) BuildArtifacts(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "BuildArtifacts", reflect.TypeOf((*MockPlugin)(nil).BuildArtifacts), arg0, arg1, arg2, arg3)
 }
 
 // Detect mocks base method
-func (m *MockPlugin) Detect(arg0 context.Context, arg1 client.Reference, arg2 *config.Config) error {
+func (m *MockPlugin) Detect(arg0 context.Context, arg1 client.Reference, arg2 *config.Config) (*packer2llb.Detection, error) {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "Detect", arg0, arg1, arg2)
-	ret0, _ := ret[0].(error)
-	return ret0
+	ret0, _ := ret[0].(*packer2llb.Detection)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
 }
 
 // Detect indicates an expected call of Detect
@@ -68,3 +85,17 @@ func (mr *MockPluginMockRecorder) Detect(arg0, arg1, arg2 interface{}) *gomock.C
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Detect", reflect.TypeOf((*MockPlugin)(nil).Detect), arg0, arg1, arg2)
 }
+
+// Name mocks base method
+func (m *MockPlugin) Name() string {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Name")
+	ret0, _ := ret[0].(string)
+	return ret0
+}
+
+// Name indicates an expected call of Name
+func (mr *MockPluginMockRecorder) Name() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Name", reflect.TypeOf((*MockPlugin)(nil).Name))
+}
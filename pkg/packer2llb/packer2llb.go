@@ -4,7 +4,7 @@ package packer2llb
 
 import (
 	"context"
-	"errors"
+	"strings"
 
 	"github.com/EricHripko/pack.yaml/pkg/packer2llb/config"
 
@@ -13,51 +13,120 @@ import (
 	"github.com/moby/buildkit/frontend/dockerfile/dockerfile2llb"
 	"github.com/moby/buildkit/frontend/gateway/client"
 	specs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
 )
 
 // DirInstall specifies the target path that the binaries will be installed in.
 const DirInstall = "/usr/local/bin"
 
-// Detect if any of active integrations can process this project.
-func Detect(ctx context.Context, build cib.Service, config *config.Config) (plugin Plugin, err error) {
+// Detect if any of active integrations can process this project. The
+// plugin can be chosen explicitly in the configuration, otherwise exactly
+// one plugin must be compatible with the project. If no plugin is
+// compatible, nil is returned for both the plugin and the detection.
+func Detect(ctx context.Context, build cib.Service, config *config.Config) (Plugin, *Detection, error) {
 	src, err := build.Src()
 	if err != nil {
-		return
+		return nil, nil, err
 	}
 
-	for _, candidate := range plugins {
-		err = candidate.Detect(ctx, src, config)
-		if err == nil {
-			continue
+	// Explicit choice
+	if config.Plugin != "" {
+		for _, plugin := range plugins {
+			if plugin.Name() != config.Plugin {
+				continue
+			}
+			detection, err := plugin.Detect(ctx, src, config)
+			if err != nil {
+				return nil, nil, err
+			}
+			if detection == nil {
+				return nil, nil, errors.Errorf("packer2llb: plugin %s is not compatible with the project", config.Plugin)
+			}
+			return plugin, detection, nil
 		}
-		if err == ErrActivate {
-			err = nil
-			plugin = candidate
-			continue
+		return nil, nil, errors.Errorf(
+			"packer2llb: unknown plugin %s (available: %s)",
+			config.Plugin,
+			strings.Join(names(plugins), ", "),
+		)
+	}
+
+	// Automatic detection
+	var candidates []Plugin
+	var detections []*Detection
+	for _, plugin := range plugins {
+		detection, err := plugin.Detect(ctx, src, config)
+		if err != nil {
+			return nil, nil, err
+		}
+		if detection != nil {
+			candidates = append(candidates, plugin)
+			detections = append(detections, detection)
 		}
-		return
 	}
-	return
+	switch len(candidates) {
+	case 0:
+		return nil, nil, nil
+	case 1:
+		return candidates[0], detections[0], nil
+	}
+	described := make([]string, len(detections))
+	for i, detection := range detections {
+		described[i] = detection.String()
+	}
+	return nil, nil, errors.Errorf(
+		"packer2llb: multiple plugins are compatible with the project (%s), choose one with \"plugin: <name>\" in pack.yaml",
+		strings.Join(described, "; "),
+	)
+}
+
+// Returns the names of the plugins.
+func names(plugins []Plugin) []string {
+	names := make([]string, len(plugins))
+	for i, plugin := range plugins {
+		names[i] = plugin.Name()
+	}
+	return names
 }
 
 //go:generate mockgen -package packer2llb_mock -destination mock/packer2llb.go . Plugin
 
 // Plugin represents an ecosystem integration.
 type Plugin interface {
+	// Name of the plugin (used to choose the plugin explicitly).
+	Name() string
 	// Detect if this plugin is compatible with the project (in which case
-	// ErrActivate is returned).
-	Detect(ctx context.Context, src client.Reference, config *config.Config) error
-	// Build a container image for the project with this plugin.
-	Build(ctx context.Context, platform *specs.Platform, build cib.Service) (*llb.State, *dockerfile2llb.Image, error)
+	// the detected project is returned, nil otherwise).
+	Detect(ctx context.Context, src client.Reference, config *config.Config) (*Detection, error)
+	// Build a container image for the detected project with this plugin.
+	Build(ctx context.Context, platform *specs.Platform, build cib.Service, detection *Detection) (*llb.State, *dockerfile2llb.Image, error)
+	// BuildArtifacts builds the detected project with this plugin and returns
+	// a filesystem that contains only the installed binaries (i.e., the
+	// contents of DirInstall).
+	BuildArtifacts(ctx context.Context, platform *specs.Platform, build cib.Service, detection *Detection) (*llb.State, error)
+}
+
+// Configurable is implemented by plugins that accept additional
+// configuration in pack.yaml.
+type Configurable interface {
+	// Schema returns the top-level key for the configuration of the plugin
+	// along with a prototype of its structure.
+	Schema() (key string, prototype interface{})
 }
 
-// ErrActivate is returned by plugin's Detect function when plugin detected
-// a compatible project.
-var ErrActivate = errors.New("packer2llb: activate plugin")
+// Tester is implemented by plugins that can run the tests of the project.
+type Tester interface {
+	// Test runs the tests of the detected project (failing the build if any
+	// of the tests fail) and returns a filesystem with the test reports.
+	Test(ctx context.Context, platform *specs.Platform, build cib.Service, detection *Detection) (*llb.State, error)
+}
 
 // Register the plugin for the integration.
 func Register(plugin Plugin) {
 	plugins = append(plugins, plugin)
+	if configurable, ok := plugin.(Configurable); ok {
+		config.RegisterSection(configurable.Schema())
+	}
 }
 
 // Clear all plugin registrations.
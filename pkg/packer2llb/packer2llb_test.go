@@ -1,10 +1,11 @@
-package packer2llb
+package packer2llb_test
 
 import (
 	"context"
 	"errors"
 	"testing"
 
+	"github.com/EricHripko/pack.yaml/pkg/packer2llb"
 	"github.com/EricHripko/pack.yaml/pkg/packer2llb/config"
 	packer2llb_mock "github.com/EricHripko/pack.yaml/pkg/packer2llb/mock"
 
@@ -32,16 +33,38 @@ func (suite *pluginTestSuite) SetupTest() {
 func (suite *pluginTestSuite) TearDownTest() {
 	suite.ctrl.Finish()
 
-	Clear()
+	packer2llb.Clear()
 }
 
 func (suite *pluginTestSuite) TestRegister() {
 	// Act
-	Register(suite.plugin)
+	packer2llb.Register(suite.plugin)
 
 	// Assert
-	require.Len(suite.T(), plugins, 1)
-	require.Same(suite.T(), suite.plugin, plugins[0])
+	require.Len(suite.T(), packer2llb.Plugins(), 1)
+	require.Same(suite.T(), suite.plugin, packer2llb.Plugins()[0])
+}
+
+type configurablePlugin struct {
+	*packer2llb_mock.MockPlugin
+}
+
+func (configurablePlugin) Schema() (string, interface{}) {
+	return "configurable", struct{ Version string }{}
+}
+
+func (suite *pluginTestSuite) TestRegisterConfigurable() {
+	// Arrange
+	plugin := configurablePlugin{suite.plugin}
+
+	// Act
+	packer2llb.Register(plugin)
+
+	// Assert
+	require.Len(suite.T(), packer2llb.Plugins(), 1)
+	schema := config.NewSchema()
+	require.Contains(suite.T(), schema.Properties, "configurable")
+	require.Contains(suite.T(), schema.Properties["configurable"].Properties, "version")
 }
 
 func (suite *pluginTestSuite) TestDetectSrcFails() {
@@ -53,7 +76,7 @@ func (suite *pluginTestSuite) TestDetectSrcFails() {
 		Return(nil, expected)
 
 	// Act
-	_, actual := Detect(suite.ctx, suite.build, cfg)
+	_, _, actual := packer2llb.Detect(suite.ctx, suite.build, cfg)
 
 	// Assert
 	require.Same(suite.T(), expected, actual)
@@ -66,14 +89,14 @@ func (suite *pluginTestSuite) TestDetectFails() {
 	suite.build.EXPECT().
 		Src().
 		Return(src, nil)
-	Register(suite.plugin)
+	packer2llb.Register(suite.plugin)
 	expected := errors.New("something went wrong")
 	suite.plugin.EXPECT().
 		Detect(suite.ctx, src, cfg).
-		Return(expected)
+		Return(nil, expected)
 
 	// Act
-	_, actual := Detect(suite.ctx, suite.build, cfg)
+	_, _, actual := packer2llb.Detect(suite.ctx, suite.build, cfg)
 
 	// Assert
 	require.Same(suite.T(), expected, actual)
@@ -86,17 +109,18 @@ func (suite *pluginTestSuite) TestDetectNotFound() {
 	suite.build.EXPECT().
 		Src().
 		Return(src, nil)
-	Register(suite.plugin)
+	packer2llb.Register(suite.plugin)
 	suite.plugin.EXPECT().
 		Detect(suite.ctx, src, cfg).
-		Return(nil)
+		Return(nil, nil)
 
 	// Act
-	plugin, err := Detect(suite.ctx, suite.build, cfg)
+	plugin, detection, err := packer2llb.Detect(suite.ctx, suite.build, cfg)
 
 	// Assert
 	require.Nil(suite.T(), err)
 	require.Nil(suite.T(), plugin)
+	require.Nil(suite.T(), detection)
 }
 
 func (suite *pluginTestSuite) TestDetectSucceeds() {
@@ -106,17 +130,133 @@ func (suite *pluginTestSuite) TestDetectSucceeds() {
 	suite.build.EXPECT().
 		Src().
 		Return(src, nil)
-	Register(suite.plugin)
+	packer2llb.Register(suite.plugin)
+	expected := &packer2llb.Detection{Plugin: "go"}
 	suite.plugin.EXPECT().
 		Detect(suite.ctx, src, cfg).
-		Return(ErrActivate)
+		Return(expected, nil)
 
 	// Act
-	plugin, err := Detect(suite.ctx, suite.build, cfg)
+	plugin, detection, err := packer2llb.Detect(suite.ctx, suite.build, cfg)
 
 	// Assert
 	require.Nil(suite.T(), err)
 	require.Same(suite.T(), suite.plugin, plugin)
+	require.Same(suite.T(), expected, detection)
+}
+
+func (suite *pluginTestSuite) TestDetectAmbiguous() {
+	// Arrange
+	cfg := &config.Config{}
+	src := cib_mock.NewMockReference(suite.ctrl)
+	suite.build.EXPECT().
+		Src().
+		Return(src, nil)
+	other := packer2llb_mock.NewMockPlugin(suite.ctrl)
+	packer2llb.Register(suite.plugin)
+	packer2llb.Register(other)
+	suite.plugin.EXPECT().
+		Detect(suite.ctx, src, cfg).
+		Return(&packer2llb.Detection{
+			Plugin:     "go",
+			Confidence: packer2llb.ConfidenceHigh,
+			Reasons:    []string{"found go.mod"},
+		}, nil)
+	other.EXPECT().
+		Detect(suite.ctx, src, cfg).
+		Return(&packer2llb.Detection{
+			Plugin:     "node",
+			Confidence: packer2llb.ConfidenceHigh,
+			Reasons:    []string{"found package.json"},
+		}, nil)
+
+	// Act
+	plugin, detection, err := packer2llb.Detect(suite.ctx, suite.build, cfg)
+
+	// Assert
+	require.Nil(suite.T(), plugin)
+	require.Nil(suite.T(), detection)
+	require.NotNil(suite.T(), err)
+	require.Contains(suite.T(), err.Error(), "go with confidence 100: found go.mod")
+	require.Contains(suite.T(), err.Error(), "node with confidence 100: found package.json")
+	require.Contains(suite.T(), err.Error(), "plugin: <name>")
+}
+
+func (suite *pluginTestSuite) TestDetectExplicit() {
+	// Arrange
+	cfg := &config.Config{Plugin: "node"}
+	src := cib_mock.NewMockReference(suite.ctrl)
+	suite.build.EXPECT().
+		Src().
+		Return(src, nil)
+	other := packer2llb_mock.NewMockPlugin(suite.ctrl)
+	packer2llb.Register(suite.plugin)
+	packer2llb.Register(other)
+	suite.plugin.EXPECT().
+		Name().
+		Return("go")
+	other.EXPECT().
+		Name().
+		Return("node")
+	expected := &packer2llb.Detection{Plugin: "node"}
+	other.EXPECT().
+		Detect(suite.ctx, src, cfg).
+		Return(expected, nil)
+
+	// Act
+	plugin, detection, err := packer2llb.Detect(suite.ctx, suite.build, cfg)
+
+	// Assert
+	require.Nil(suite.T(), err)
+	require.Same(suite.T(), other, plugin)
+	require.Same(suite.T(), expected, detection)
+}
+
+func (suite *pluginTestSuite) TestDetectExplicitIncompatible() {
+	// Arrange
+	cfg := &config.Config{Plugin: "go"}
+	src := cib_mock.NewMockReference(suite.ctrl)
+	suite.build.EXPECT().
+		Src().
+		Return(src, nil)
+	packer2llb.Register(suite.plugin)
+	suite.plugin.EXPECT().
+		Name().
+		Return("go")
+	suite.plugin.EXPECT().
+		Detect(suite.ctx, src, cfg).
+		Return(nil, nil)
+
+	// Act
+	plugin, _, err := packer2llb.Detect(suite.ctx, suite.build, cfg)
+
+	// Assert
+	require.Nil(suite.T(), plugin)
+	require.NotNil(suite.T(), err)
+	require.Contains(suite.T(), err.Error(), "not compatible")
+}
+
+func (suite *pluginTestSuite) TestDetectExplicitUnknown() {
+	// Arrange
+	cfg := &config.Config{Plugin: "rust"}
+	src := cib_mock.NewMockReference(suite.ctrl)
+	suite.build.EXPECT().
+		Src().
+		Return(src, nil)
+	packer2llb.Register(suite.plugin)
+	suite.plugin.EXPECT().
+		Name().
+		Return("go").
+		Times(2)
+
+	// Act
+	plugin, _, err := packer2llb.Detect(suite.ctx, suite.build, cfg)
+
+	// Assert
+	require.Nil(suite.T(), plugin)
+	require.NotNil(suite.T(), err)
+	require.Contains(suite.T(), err.Error(), "unknown plugin rust")
+	require.Contains(suite.T(), err.Error(), "available: go")
 }
 
 func TestPlugin(t *testing.T) {
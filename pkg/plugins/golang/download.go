@@ -0,0 +1,134 @@
+package golang
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/moby/buildkit/client/llb"
+	"golang.org/x/mod/modfile"
+)
+
+const (
+	// Directory where the module files are mounted for downloading the
+	// modules.
+	dirModFiles = "/modfiles"
+	// GOPATH that the modules of the project are downloaded into.
+	dirModules = "/modules"
+	// Location of the module cache inside of GOPATH.
+	dirModCache = "/pkg/mod"
+	// Location of the downloaded module files inside of the module cache,
+	// which is laid out as a module proxy.
+	dirModDownload = "/cache/download"
+)
+
+// Downloads the modules of the project in a dedicated step. The step only
+// depends on the module files, so unlike a cache mount its result is a
+// regular layer that can be exported (e.g., with --cache-to) and is reused
+// until the dependencies change. The result has the module cache (under
+// dirModCache) with only the modules of the project.
+//
+// The go-mod cache mount is shared by all the projects built on the worker,
+// so it's only used as a module proxy for the download and updated
+// afterwards. This way only the new modules are fetched when the
+// dependencies change.
+func downloadModules(state llb.State, src llb.State, pluginConfig *Config, env []llb.RunOption) llb.State {
+	shared := dirGoModCache + dirModDownload
+	downloaded := dirModules + dirModCache + dirModDownload
+	run := append(env[:len(env):len(env)],
+		llb.AddMount(dirModFiles, moduleFiles(src, pluginConfig), llb.Readonly),
+		llb.AddMount(
+			dirGoModCache,
+			llb.Scratch(),
+			llb.AsPersistentCacheDir("go-mod", llb.CacheMountPrivate),
+		),
+		llb.Dir(dirModFiles),
+		llb.Args([]string{"/bin/sh", "-c", fmt.Sprintf(
+			`export GOPROXY="file://%s,$(go env GOPROXY)" && GOPATH=%s go mod download && mkdir -p %s && cp -a %s/. %s/`,
+			shared, dirModules, shared, downloaded, shared,
+		)}),
+		llb.WithCustomName("Download modules"),
+	)
+	return state.Run(run...).AddMount(dirModules, llb.Scratch())
+}
+
+// Returns the state with only the module files of the project copied from
+// the sources.
+func moduleFiles(src llb.State, pluginConfig *Config) llb.State {
+	// The checksum files are optional, so they are matched with a pattern
+	// that is allowed to match nothing
+	files := []string{"go.mod", "go.su[m]"}
+	if pluginConfig.DependencyMode == DMWorkspace {
+		files = []string{"go.work", "go.work.su[m]"}
+	}
+	dirs := pluginConfig.modDirs
+	if len(dirs) == 0 {
+		dirs = []string{"."}
+	}
+	for _, dir := range dirs {
+		if dir != "." {
+			files = append(files, path.Join(dir, "go.mod"), path.Join(dir, "go.su[m]"))
+		} else if pluginConfig.DependencyMode == DMWorkspace {
+			files = append(files, "go.mod", "go.su[m]")
+		}
+	}
+
+	var action *llb.FileAction
+	for _, file := range files {
+		dir := strings.TrimSuffix(path.Join("/", path.Dir(file)), "/") + "/"
+		info := &llb.CopyInfo{
+			AllowWildcard:      true,
+			AllowEmptyWildcard: true,
+			CreateDestPath:     true,
+		}
+		if action == nil {
+			action = llb.Copy(src, path.Join("/", file), dir, info)
+		} else {
+			action = action.Copy(src, path.Join("/", file), dir, info)
+		}
+	}
+	return llb.Scratch().File(action, llb.WithCustomName("Copy module files"))
+}
+
+// Returns the directories of the modules that replace the dependencies with
+// local copies (relative to the root). The go.mod file must be parsed with
+// modfile.ParseLax, which only keeps the replace directives in the syntax.
+func localReplaces(dir string, syntax *modfile.FileSyntax) []string {
+	var lines [][]string
+	for _, stmt := range syntax.Stmt {
+		switch stmt := stmt.(type) {
+		case *modfile.Line:
+			if len(stmt.Token) > 0 && stmt.Token[0] == "replace" {
+				lines = append(lines, stmt.Token[1:])
+			}
+		case *modfile.LineBlock:
+			if len(stmt.Token) > 0 && stmt.Token[0] == "replace" {
+				for _, line := range stmt.Line {
+					lines = append(lines, line.Token)
+				}
+			}
+		}
+	}
+
+	var dirs []string
+	for _, tokens := range lines {
+		// Local replacements have no version (e.g., example.com/lib => ./lib)
+		if len(tokens) < 3 || tokens[len(tokens)-2] != "=>" {
+			continue
+		}
+		target := tokens[len(tokens)-1]
+		if unquoted, err := strconv.Unquote(target); err == nil {
+			target = unquoted
+		}
+		if target != "." && target != ".." && !strings.HasPrefix(target, "./") && !strings.HasPrefix(target, "../") {
+			continue
+		}
+		target = path.Join(dir, target)
+		if target == ".." || strings.HasPrefix(target, "../") {
+			continue
+		}
+		dirs = append(dirs, target)
+	}
+	return dirs
+}
@@ -0,0 +1,65 @@
+package golang
+
+import (
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/moby/buildkit/client/llb"
+	specs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/mod/modfile"
+)
+
+func TestLocalReplaces(t *testing.T) {
+	// Arrange
+	data := []byte(`
+module github.com/notareal/project
+
+go 1.15
+
+replace github.com/notareal/lib => ./lib
+
+replace (
+	github.com/notareal/other v1.0.0 => "../shared/other"
+	github.com/notareal/fork => github.com/someone/fork v1.2.3
+	github.com/notareal/outside => ../../../outside
+)
+`)
+	goMod, err := modfile.ParseLax("go.mod", data, nil)
+	require.Nil(t, err)
+
+	// Act
+	dirs := localReplaces("services/api", goMod.Syntax)
+
+	// Assert
+	require.Equal(t, []string{"services/api/lib", "services/shared/other"}, dirs)
+}
+
+func (suite *golangTestSuite) TestBuildArtifactsDownload() {
+	// Arrange
+	suite.pluginConfig.DependencyMode = DMGoMod
+	suite.pluginConfig.Version = "1.14"
+	suite.pluginConfig.Proxy = "https://proxy.example.com"
+	suite.pluginConfig.modDirs = []string{".", "lib"}
+
+	platform := &specs.Platform{OS: "linux", Architecture: "amd64"}
+	suite.build.EXPECT().
+		From("golang:1.14", platform, gomock.Any()).
+		Return(llb.Scratch(), nil, nil)
+	suite.build.EXPECT().
+		SrcState().
+		Return(llb.Scratch(), nil)
+
+	// Act
+	state, err := suite.plugin.BuildArtifacts(suite.ctx, platform, suite.build, suite.detection)
+
+	// Assert
+	require.Nil(suite.T(), err)
+	require.True(suite.T(), suite.contains(state, dirModFiles))
+	require.True(suite.T(), suite.contains(state, "/lib/go.su[m]"))
+	require.False(suite.T(), suite.contains(state, "go.work"))
+	require.True(suite.T(), suite.contains(state, "go-mod"))
+	require.True(suite.T(), suite.contains(state, `GOPROXY="file:///go/pkg/mod/cache/download,$(go env GOPROXY)"`))
+	require.True(suite.T(), suite.contains(state, "GOPATH=/modules go mod download"))
+	require.False(suite.T(), suite.contains(state, "cp -a /go/pkg/mod/. "))
+}
@@ -0,0 +1,47 @@
+package golang
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/moby/buildkit/client/llb"
+)
+
+// Build arguments that are passed to the go commands as environment
+// variables (e.g., --build-arg GOPROXY=https://proxy.example.com).
+var envArgs = []string{"GOPROXY", "GONOPROXY", "GOSUMDB", "GONOSUMDB", "GOFLAGS"}
+
+// Returns the environment for the go commands. The dedicated settings take
+// precedence over the variables in the configuration, while the build
+// arguments take precedence over both.
+func goEnv(pluginConfig *Config, args map[string]string) []llb.RunOption {
+	env := make(map[string]string)
+	for key, value := range pluginConfig.Env {
+		env[key] = value
+	}
+	if pluginConfig.Proxy != "" {
+		env["GOPROXY"] = pluginConfig.Proxy
+	}
+	if pluginConfig.SumDB != "" {
+		env["GOSUMDB"] = pluginConfig.SumDB
+	}
+	if len(pluginConfig.Flags) > 0 {
+		env["GOFLAGS"] = strings.Join(pluginConfig.Flags, " ")
+	}
+	for _, key := range envArgs {
+		if value, ok := args[key]; ok {
+			env[key] = value
+		}
+	}
+
+	keys := make([]string, 0, len(env))
+	for key := range env {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	run := make([]llb.RunOption, 0, len(keys))
+	for _, key := range keys {
+		run = append(run, llb.AddEnv(key, env[key]))
+	}
+	return run
+}
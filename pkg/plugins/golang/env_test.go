@@ -0,0 +1,70 @@
+package golang
+
+import (
+	"github.com/golang/mock/gomock"
+	"github.com/moby/buildkit/client/llb"
+	specs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/require"
+)
+
+func (suite *golangTestSuite) TestBuildArtifactsEnv() {
+	// Arrange
+	suite.pluginConfig.Version = "1.14"
+	suite.pluginConfig.Env = map[string]string{
+		"GOPROXY":      "https://ignored.example.com",
+		"GOINSECURE":   "insecure.example.com",
+		"GONOSUMDB":    "ignored.example.com",
+		"GOEXPERIMENT": "none",
+	}
+	suite.pluginConfig.Proxy = "https://proxy.example.com"
+	suite.pluginConfig.SumDB = "off"
+	suite.pluginConfig.Flags = []string{"-trimpath", "-buildvcs=false"}
+	suite.buildArgs = map[string]string{
+		"GONOSUMDB": "corp.example.com",
+		"OTHER":     "value",
+	}
+
+	platform := &specs.Platform{OS: "linux", Architecture: "amd64"}
+	suite.build.EXPECT().
+		From("golang:1.14", platform, gomock.Any()).
+		Return(llb.Scratch(), nil, nil)
+	suite.build.EXPECT().
+		SrcState().
+		Return(llb.Scratch(), nil)
+
+	// Act
+	state, err := suite.plugin.BuildArtifacts(suite.ctx, platform, suite.build, suite.detection)
+
+	// Assert
+	require.Nil(suite.T(), err)
+	require.True(suite.T(), suite.contains(state, "GOPROXY=https://proxy.example.com"))
+	require.True(suite.T(), suite.contains(state, "GOSUMDB=off"))
+	require.True(suite.T(), suite.contains(state, "GOFLAGS=-trimpath -buildvcs=false"))
+	require.True(suite.T(), suite.contains(state, "GOINSECURE=insecure.example.com"))
+	require.True(suite.T(), suite.contains(state, "GONOSUMDB=corp.example.com"))
+	require.False(suite.T(), suite.contains(state, "ignored.example.com"))
+	require.False(suite.T(), suite.contains(state, "OTHER"))
+}
+
+func (suite *golangTestSuite) TestBuildArtifactsEnvArgs() {
+	// Arrange
+	suite.pluginConfig.Version = "1.14"
+	suite.pluginConfig.Proxy = "https://proxy.example.com"
+	suite.buildArgs = map[string]string{"GOPROXY": "https://farm.example.com"}
+
+	platform := &specs.Platform{OS: "linux", Architecture: "amd64"}
+	suite.build.EXPECT().
+		From("golang:1.14", platform, gomock.Any()).
+		Return(llb.Scratch(), nil, nil)
+	suite.build.EXPECT().
+		SrcState().
+		Return(llb.Scratch(), nil)
+
+	// Act
+	state, err := suite.plugin.BuildArtifacts(suite.ctx, platform, suite.build, suite.detection)
+
+	// Assert
+	require.Nil(suite.T(), err)
+	require.True(suite.T(), suite.contains(state, "GOPROXY=https://farm.example.com"))
+	require.False(suite.T(), suite.contains(state, "proxy.example.com"))
+}
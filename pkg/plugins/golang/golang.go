@@ -3,6 +3,7 @@ package golang
 import (
 	"context"
 	"fmt"
+	"path"
 	"regexp"
 	"strings"
 
@@ -10,7 +11,6 @@ import (
 	"github.com/EricHripko/pack.yaml/pkg/packer2llb/config"
 
 	"github.com/EricHripko/buildkit-fdk/pkg/cib"
-	"github.com/mitchellh/mapstructure"
 	"github.com/moby/buildkit/client/llb"
 	"github.com/moby/buildkit/frontend/dockerfile/dockerfile2llb"
 	"github.com/moby/buildkit/frontend/gateway/client"
@@ -21,79 +21,164 @@ import (
 	"golang.org/x/sync/errgroup"
 )
 
+// Top-level key in pack.yaml for the configuration of the plugin.
+const section = "go"
+
 // Regular expression for detecting a Go project.
-var fileRegex = regexp.MustCompile(`(?:.*\.go)|(?:go\.mod)|(?:go\.sum)`)
+var fileRegex = regexp.MustCompile(`(?:.*\.go)|(?:go\.mod)|(?:go\.sum)|(?:go\.work)`)
 
 // Errors returned by the plugin.
 var (
-	ErrUnknownDep    = errors.New("golang: unknown dependency method")
-	ErrModIncomplete = errors.New("golang: incomplete go.mod file")
+	ErrUnknownDep       = errors.New("golang: unknown dependency method")
+	ErrModIncomplete    = errors.New("golang: incomplete go.mod file")
+	ErrWorkIncomplete   = errors.New("golang: incomplete go.work file")
+	ErrGopathIncomplete = errors.New("golang: version and importPath are required in gopath mode")
+	ErrNoMain           = errors.New("golang: no main packages match the selection")
 )
 
 // DependencyMode describes all the supported methods for dependency resolution.
 type DependencyMode string
 
+// Values returns the dependency modes that can be configured.
+func (DependencyMode) Values() []string {
+	return []string{DMGoMod, DMWorkspace, DMVendor, DMGopath}
+}
+
 const (
 	// DMUnknown represents an unrecognised dependency method.
 	DMUnknown = "unknown"
 	// DMGoMod represents a go.mod/go.sum project.
 	DMGoMod = "modules"
+	// DMWorkspace represents a go.work workspace with several modules.
+	DMWorkspace = "workspace"
+	// DMVendor represents a go.mod project with a committed vendor directory.
+	DMVendor = "vendor"
+	// DMGopath represents a legacy project built in GOPATH mode.
+	DMGopath = "gopath"
 )
 
 // Config for the Go plugin.
 type Config struct {
 	// Version of Go used.
 	Version string
+	// Image to build in (e.g., a registry mirror or an image pinned by
+	// digest). Tagged with the version of Go unless it has a tag or digest.
+	Image string
 	// Method for declaring dependencies.
 	DependencyMode DependencyMode
+	// Import path of the project in gopath mode (e.g., github.com/example/app).
+	ImportPath string
+	// Patterns of the packages to build (e.g., ./cmd/...).
+	Packages []string
+	// Patterns of the packages to exclude from the build.
+	Exclude []string
 	// Build tags.
 	Tags []string
+	// Environment variables for the go commands.
+	Env map[string]string
+	// Module proxy (GOPROXY), e.g., https://proxy.example.com,direct.
+	Proxy string
+	// Checksum database (GOSUMDB), e.g., off.
+	SumDB string `mapstructure:"sumdb"`
+	// Flags for the go commands (GOFLAGS), e.g., -trimpath.
+	Flags []string
+	// Patterns of the private modules (e.g., gitlab.example.com/*) that are
+	// downloaded directly from their repositories (GOPRIVATE).
+	Private []string
+	// Credentials for downloading the private modules.
+	Auth AuthConfig
+	// Flags for the linker (e.g., -X main.version={{.Version}}). See
+	// LDFlagsVars for the variables available in the templates.
+	LDFlags []string `mapstructure:"ldflags"`
+	// Whether cgo is enabled (disabled for cross-compiled builds and default
+	// of the build image otherwise if omitted).
+	CGO *bool `mapstructure:"cgo"`
+	// Whether the binaries must be statically linked.
+	Static bool
+	// Runtime image: static, scratch, base, cc, nonroot or a custom image
+	// reference (picked automatically if omitted).
+	Runtime string
+	// Settings for running the tests.
+	Test TestConfig
+
+	// Main packages to build (if selected with Packages or Exclude).
+	mains []string
+	// Modules used by the workspace.
+	modules []workModule
+	// Directories with the module files needed to download the modules.
+	modDirs []string
 }
 
 // Plugin for Go ecosystem.
-type Plugin struct {
-	// General configuration supplied by the user.
-	config *config.Config
-	// Configuration for the plugin.
-	pluginConfig *Config
-	// Name of the project.
-	name string
-}
+type Plugin struct{}
 
-// NewPlugin creates a new Go plugin with correct defaults.
+// NewPlugin creates a new Go plugin.
 func NewPlugin() *Plugin {
-	return &Plugin{
-		config: config.New(),
-		pluginConfig: &Config{
-			DependencyMode: DMUnknown,
-		},
-	}
+	return &Plugin{}
+}
+
+// Name of the plugin.
+func (p *Plugin) Name() string {
+	return "go"
+}
+
+// Schema returns the configuration section of the plugin.
+func (p *Plugin) Schema() (string, interface{}) {
+	return section, Config{}
 }
 
+// Used to stop looking for Go files once one is found.
+var errFound = errors.New("golang: found")
+
 // Detect if this is a Go project and identify the context.
-func (p *Plugin) Detect(ctx context.Context, src client.Reference, config *config.Config) error {
-	// Save config
-	p.config = config
-	if other, ok := p.config.Other["go"]; ok {
-		err := mapstructure.Decode(other, p.pluginConfig)
-		if err != nil {
-			return err
-		}
+func (p *Plugin) Detect(ctx context.Context, src client.Reference, config *config.Config) (*packer2llb.Detection, error) {
+	pluginConfig := &Config{DependencyMode: DMUnknown}
+	if err := config.Section(section, pluginConfig); err != nil {
+		return nil, err
+	}
+	if pluginConfig.Auth.SSH != "" && pluginConfig.Auth.KnownHosts == "" {
+		// The host keys are always verified, so SSH can't work without them
+		return nil, config.ErrorAt(
+			section+".auth.ssh",
+			"knownHosts must be set to verify the host keys of the private repositories",
+		)
+	}
+	detection := &packer2llb.Detection{
+		Plugin:     p.Name(),
+		Confidence: packer2llb.ConfidenceLow,
+		Config:     config,
+		Data:       pluginConfig,
 	}
 
 	// Look for go files
 	err := cib.WalkRecursive(ctx, src, func(file *fsutil.Stat) error {
 		if fileRegex.MatchString(file.Path) {
-			return packer2llb.ErrActivate
+			detection.Reasons = append(detection.Reasons, "found "+file.Path)
+			return errFound
 		}
 		return nil
 	})
-	if err != packer2llb.ErrActivate {
-		return err
+	if err == nil {
+		return nil, nil
+	}
+	if err != errFound {
+		return nil, err
 	}
 
 	// Identify dependency method
-	if p.pluginConfig.DependencyMode == DMUnknown {
+	if pluginConfig.DependencyMode == DMUnknown {
+		_, err := src.ReadFile(ctx, client.ReadRequest{Filename: "go.work"})
+		if err == nil {
+			pluginConfig.DependencyMode = DMWorkspace
+		}
+	}
+	if pluginConfig.DependencyMode == DMUnknown {
+		_, err := src.ReadFile(ctx, client.ReadRequest{Filename: "vendor/modules.txt"})
+		if err == nil {
+			pluginConfig.DependencyMode = DMVendor
+		}
+	}
+	if pluginConfig.DependencyMode == DMUnknown {
 		goModGroup := new(errgroup.Group)
 		goModGroup.Go(func() error {
 			_, err := src.ReadFile(ctx, client.ReadRequest{Filename: "go.mod"})
@@ -104,38 +189,112 @@ func (p *Plugin) Detect(ctx context.Context, src client.Reference, config *confi
 			return err
 		})
 		if err := goModGroup.Wait(); err == nil {
-			p.pluginConfig.DependencyMode = DMGoMod
+			pluginConfig.DependencyMode = DMGoMod
 		}
 	}
 
 	// Pick up the project context from the dependency metadata
-	switch p.pluginConfig.DependencyMode {
+	switch pluginConfig.DependencyMode {
 	case DMUnknown:
-		return ErrUnknownDep
-	case DMGoMod:
+		return nil, ErrUnknownDep
+	case DMGoMod, DMVendor:
 		data, err := src.ReadFile(ctx, client.ReadRequest{Filename: "go.mod"})
 		if err != nil {
-			return errors.Wrap(err, "fail to read go.mod")
+			return nil, errors.Wrap(err, "fail to read go.mod")
 		}
 		goMod, err := modfile.ParseLax("go.mod", data, nil)
 		if err != nil {
-			return errors.Wrap(err, "fail to parse go.mod")
+			return nil, errors.Wrap(err, "fail to parse go.mod")
 		}
 		if goMod.Go == nil || goMod.Module == nil {
-			return ErrModIncomplete
+			return nil, ErrModIncomplete
+		}
+		if pluginConfig.Version == "" {
+			pluginConfig.Version = moduleVersion(goMod.Go, goMod.Syntax)
+		}
+		detection.Confidence = packer2llb.ConfidenceHigh
+		detection.Project = goMod.Module.Mod.Path
+		detection.Reasons = append(detection.Reasons, "found module "+detection.Project)
+		pluginConfig.modDirs = appendUnique([]string{"."}, localReplaces(".", goMod.Syntax)...)
+	case DMWorkspace:
+		work, err := readWorkspace(ctx, src)
+		if err != nil {
+			return nil, err
+		}
+		if pluginConfig.Version == "" {
+			pluginConfig.Version = work.Version
+		}
+		detection.Confidence = packer2llb.ConfidenceHigh
+		detection.Project = work.Modules[0].Path
+		for _, module := range work.Modules {
+			detection.Reasons = append(detection.Reasons, "found module "+module.Path)
+		}
+		pluginConfig.modules = work.Modules
+		pluginConfig.modDirs = work.Dirs
+	case DMGopath:
+		if pluginConfig.Version == "" || pluginConfig.ImportPath == "" {
+			return nil, ErrGopathIncomplete
+		}
+		detection.Confidence = packer2llb.ConfidenceHigh
+		detection.Project = pluginConfig.ImportPath
+	}
+	detection.Version = pluginConfig.Version
+
+	// Identify the binaries. Without an explicit list of packages the go
+	// tool decides what gets built, so the binaries are left to be found in
+	// the build result
+	if len(pluginConfig.Packages) == 0 && len(pluginConfig.Exclude) == 0 && pluginConfig.DependencyMode != DMWorkspace {
+		return detection, nil
+	}
+	packages := pluginConfig.Packages
+	if len(packages) == 0 {
+		packages = []string{allPackages}
+	}
+	var modules []string
+	switch pluginConfig.DependencyMode {
+	case DMGoMod, DMVendor:
+		modules = []string{"."}
+	case DMWorkspace:
+		modules = make([]string, 0, len(pluginConfig.modules))
+		for _, module := range pluginConfig.modules {
+			modules = append(modules, module.Dir)
+		}
+	}
+	mains, err := findMains(ctx, src, packages, pluginConfig.Exclude, modules)
+	if err != nil {
+		return nil, err
+	}
+	if pluginConfig.DependencyMode == DMWorkspace {
+		// Packages outside of the workspace modules can't be built and
+		// ./... only matches the module in the current directory
+		var used []string
+		for _, dir := range mains {
+			if findModule(pluginConfig.modules, dir) != nil {
+				used = append(used, dir)
+			}
 		}
-		if p.pluginConfig.Version == "" {
-			p.pluginConfig.Version = goMod.Go.Version
+		mains = used
+	}
+	if len(mains) == 0 {
+		return nil, ErrNoMain
+	}
+	pluginConfig.mains = mains
+	for _, dir := range mains {
+		name := binaryName(detection.Project, dir)
+		if module := findModule(pluginConfig.modules, dir); module != nil {
+			name = binaryName(module.Path, module.rel(dir))
 		}
-		p.name = goMod.Module.Mod.Path
+		detection.Binaries = append(detection.Binaries, name)
 	}
 
-	return packer2llb.ErrActivate
+	return detection, nil
 }
 
 const (
 	// Source directory.
 	dirSrc = "/src"
+	// GOPATH of the golang image.
+	dirGoPath = "/go"
 	// Directory where installed binaries go.
 	dirInstall = "/install"
 	// Directory for caching dependencies of go.mod/go.sum project.
@@ -145,42 +304,163 @@ const (
 )
 
 // Build the image for this Go project.
-func (p *Plugin) Build(ctx context.Context, platform *specs.Platform, build cib.Service) (*llb.State, *dockerfile2llb.Image, error) {
-	// Choose base image
-	base := "golang:" + p.pluginConfig.Version
-	state, _, err := build.From(
-		base,
-		platform,
-		fmt.Sprintf("Base build image is %s", base),
-	)
+func (p *Plugin) Build(ctx context.Context, platform *specs.Platform, build cib.Service, detection *packer2llb.Detection) (*llb.State, *dockerfile2llb.Image, error) {
+	buildState, err := p.compile(ctx, platform, build, detection)
 	if err != nil {
 		return nil, nil, err
 	}
+	pluginConfig := detection.Data.(*Config)
 
-	// Fetch sources
-	src, err := build.SrcState()
+	// Runtime image
+	runtime := pluginConfig.Runtime
+	if runtime == "" || pluginConfig.Static || isStaticRuntime(runtime) {
+		dynamic, err := p.findDynamic(ctx, build, *buildState)
+		if err != nil {
+			return nil, nil, err
+		}
+		switch {
+		case dynamic != "" && pluginConfig.Static:
+			return nil, nil, errors.Errorf("golang: %s is not statically linked", dynamic)
+		case dynamic != "" && runtime != "":
+			return nil, nil, errors.Errorf("golang: %s is not statically linked and cannot run in %s runtime", dynamic, runtime)
+		case runtime == "" && dynamic == "":
+			runtime = RTStatic
+		case runtime == "":
+			runtime = RTBase
+		}
+	}
+	state, img, err := p.runtime(platform, build, runtime, detection.Config.Debug)
 	if err != nil {
 		return nil, nil, err
 	}
+	// Install the application
+	state = state.File(
+		llb.Mkdir(packer2llb.DirInstall, 0755, llb.WithParents(true)),
+		llb.WithCustomName("Create output directory"),
+	)
+	state = state.File(
+		llb.Copy(
+			*buildState,
+			dirInstall,
+			packer2llb.DirInstall,
+			&llb.CopyInfo{CopyDirContentsOnly: true},
+		),
+		llb.WithCustomName("Install application(s)"),
+	)
+
+	return &state, img, err
+}
+
+// BuildArtifacts builds the binaries for this Go project.
+func (p *Plugin) BuildArtifacts(ctx context.Context, platform *specs.Platform, build cib.Service, detection *packer2llb.Detection) (*llb.State, error) {
+	buildState, err := p.compile(ctx, platform, build, detection)
+	if err != nil {
+		return nil, err
+	}
+
+	state := llb.Scratch().File(
+		llb.Copy(
+			*buildState,
+			dirInstall,
+			"/",
+			&llb.CopyInfo{CopyDirContentsOnly: true},
+		),
+		llb.WithCustomName("Export application(s)"),
+	)
+	return &state, nil
+}
+
+// Compiles the project and installs the binaries into dirInstall.
+func (p *Plugin) compile(ctx context.Context, platform *specs.Platform, build cib.Service, detection *packer2llb.Detection) (*llb.State, error) {
+	state, run, pluginConfig, err := p.prepare(platform, build, detection, true)
+	if err != nil {
+		return nil, err
+	}
+
 	// Create output directory
 	state = state.File(
 		llb.Mkdir(dirInstall, 0755),
 		llb.WithCustomName("Create build output directory"),
 	)
-	// Build
-	args := []string{"go", "install", "-v"}
-	if len(p.pluginConfig.Tags) > 0 {
-		args = append(args, "-tags")
-		args = append(args, strings.Join(p.pluginConfig.Tags, ","))
+	// Build (go install refuses to install cross-compiled binaries into
+	// GOBIN, so the output directory is set explicitly)
+	args := []string{"go", "build", "-v", "-o", dirInstall + "/"}
+	var ldflags []string
+	if len(pluginConfig.LDFlags) > 0 {
+		vars, err := p.ldflagsVars(ctx, build, state)
+		if err != nil {
+			return nil, err
+		}
+		flags, err := renderLDFlags(pluginConfig.LDFlags, vars)
+		if err != nil {
+			return nil, err
+		}
+		ldflags = append(ldflags, flags)
+	}
+	tags := pluginConfig.Tags
+	if pluginConfig.Static {
+		// Use pure Go implementations instead of the C library and link
+		// the C code (if any) statically
+		tags = append(tags[:len(tags):len(tags)], "netgo", "osusergo")
+		ldflags = append(ldflags, "-extldflags -static")
+	}
+	if len(ldflags) > 0 {
+		args = append(args, "-ldflags", strings.Join(ldflags, " "))
+	}
+	args = append(args, tagsFlag(tags)...)
+	args = append(args, modFlag(pluginConfig)...)
+	if len(pluginConfig.mains) > 0 {
+		for _, dir := range pluginConfig.mains {
+			args = append(args, "./"+strings.TrimPrefix(dir, "."))
+		}
+	} else {
+		args = append(args, allPackages)
+	}
+
+	run = append(run,
+		llb.Args(args),
+		llb.WithCustomNamef("Build %s", detection.Project),
+	)
+	buildState := state.Dir(srcDir(pluginConfig)).Run(run...).Root()
+	return &buildState, nil
+}
+
+// Prepares the environment for running the Go toolchain on the project:
+// the build image along with the options that mount the sources and the
+// caches. When cross-compilation is allowed, the toolchain runs on the
+// platform of the worker and targets the requested platform.
+func (p *Plugin) prepare(platform *specs.Platform, build cib.Service, detection *packer2llb.Detection, cross bool) (llb.State, []llb.RunOption, *Config, error) {
+	pluginConfig, ok := detection.Data.(*Config)
+	if !ok {
+		return llb.State{}, nil, nil, errors.Errorf("golang: unexpected detection from %s", detection.Plugin)
+	}
+
+	// Choose base image (the golang image has no C cross-compilers, so cgo
+	// builds run on the target platform)
+	buildPlatform := platform
+	cross = cross && platform != nil && cgoEnabled(pluginConfig) != "1"
+	if cross {
+		buildPlatform = build.GetBuildPlatform()
+	}
+	base := buildImage(pluginConfig)
+	state, _, err := build.From(
+		base,
+		buildPlatform,
+		fmt.Sprintf("Base build image is %s", base),
+	)
+	if err != nil {
+		return llb.State{}, nil, nil, err
+	}
+
+	// Fetch sources
+	src, err := build.SrcState()
+	if err != nil {
+		return llb.State{}, nil, nil, err
 	}
-	args = append(args, "./...")
 
 	run := []llb.RunOption{
 		// Mount source code
-		llb.AddMount(dirSrc, src, llb.Readonly),
-		// Install executables
-		llb.AddEnv("GOBIN", dirInstall),
-		llb.Args(args),
+		llb.AddMount(srcDir(pluginConfig), src, llb.Readonly),
 		// Cache build outputs
 		llb.AddMount(
 			dirGoBuildCache,
@@ -188,47 +468,88 @@ func (p *Plugin) Build(ctx context.Context, platform *specs.Platform, build cib.
 			llb.AsPersistentCacheDir("go-build", llb.CacheMountPrivate),
 		),
 		llb.AddEnv("GOCACHE", dirGoBuildCache),
-		llb.WithCustomNamef("Build %s", p.name),
 	}
-	if p.pluginConfig.DependencyMode == DMGoMod {
-		// Cache modules
+	env := goEnv(pluginConfig, build.GetBuildArgs())
+	env = append(env, privateOpts(pluginConfig)...)
+	run = append(run, env...)
+	if cross {
+		run = append(run, targetEnv(platform)...)
+	}
+	cgo := cgoEnabled(pluginConfig)
+	if cross && cgo == "" {
+		// Go disables cgo when cross-compiling, so it's disabled for the
+		// platform of the worker too to produce the same binaries for every
+		// platform
+		cgo = "0"
+	}
+	if cgo != "" {
+		run = append(run, llb.AddEnv("CGO_ENABLED", cgo))
+	}
+	switch pluginConfig.DependencyMode {
+	case DMGoMod, DMWorkspace:
+		// Use the modules from the download step (the changes made by the
+		// go commands are discarded)
+		modules := downloadModules(state, src, pluginConfig, env)
 		run = append(run, llb.AddMount(
 			dirGoModCache,
-			llb.Scratch(),
-			llb.AsPersistentCacheDir("go-mod", llb.CacheMountPrivate),
+			modules,
+			llb.SourcePath(dirModCache),
+			llb.ForceNoOutput,
 		))
+	case DMGopath:
+		run = append(run, llb.AddEnv("GO111MODULE", "off"))
 	}
-	buildState := state.Dir(dirSrc).Run(run...).Root()
+	return state, run, pluginConfig, nil
+}
 
-	// Runtime image
-	base = "gcr.io/distroless/base"
-	if p.config.Debug {
-		base += ":debug"
+// Returns the directory that the sources are mounted at. In gopath mode,
+// the sources must be at their import path under GOPATH.
+func srcDir(pluginConfig *Config) string {
+	if pluginConfig.DependencyMode == DMGopath {
+		return path.Join(dirGoPath, "src", pluginConfig.ImportPath)
 	}
-	state, img, err := build.From(
-		base,
-		platform,
-		fmt.Sprintf("Base runtime image is %s", base),
-	)
-	if err != nil {
-		return nil, nil, err
+	return dirSrc
+}
+
+// Returns the flag that makes the go commands use the vendor directory (if
+// needed).
+func modFlag(pluginConfig *Config) []string {
+	if pluginConfig.DependencyMode == DMVendor {
+		return []string{"-mod=vendor"}
 	}
-	// Install the application
-	state = state.File(
-		llb.Mkdir(packer2llb.DirInstall, 0755, llb.WithParents(true)),
-		llb.WithCustomName("Create output directory"),
-	)
-	state = state.File(
-		llb.Copy(
-			buildState,
-			dirInstall,
-			packer2llb.DirInstall,
-			&llb.CopyInfo{CopyDirContentsOnly: true},
-		),
-		llb.WithCustomName("Install application(s)"),
-	)
+	return nil
+}
 
-	return &state, img, err
+// Returns the flag that enables the build tags (if any).
+func tagsFlag(tags []string) []string {
+	if len(tags) == 0 {
+		return nil
+	}
+	return []string{"-tags", strings.Join(tags, ",")}
+}
+
+// Returns the environment that makes the Go toolchain target the platform.
+func targetEnv(platform *specs.Platform) []llb.RunOption {
+	env := []llb.RunOption{
+		llb.AddEnv("GOOS", platform.OS),
+		llb.AddEnv("GOARCH", platform.Architecture),
+	}
+	if platform.Architecture == "arm" && platform.Variant != "" {
+		env = append(env, llb.AddEnv("GOARM", strings.TrimPrefix(platform.Variant, "v")))
+	}
+	return env
+}
+
+// Returns the value for CGO_ENABLED (empty to keep the default of the
+// image). Static builds disable cgo unless it's enabled explicitly.
+func cgoEnabled(pluginConfig *Config) string {
+	switch {
+	case pluginConfig.CGO != nil && *pluginConfig.CGO:
+		return "1"
+	case pluginConfig.CGO != nil || pluginConfig.Static:
+		return "0"
+	}
+	return ""
 }
 
 func init() {
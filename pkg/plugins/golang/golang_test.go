@@ -3,6 +3,9 @@ package golang
 import (
 	"context"
 	"errors"
+	"os"
+	"sort"
+	"strings"
 	"testing"
 
 	"github.com/EricHripko/pack.yaml/pkg/packer2llb"
@@ -26,20 +29,100 @@ type golangTestSuite struct {
 	build  *cib_mock.MockService
 	src    *cib_mock.MockReference
 	plugin *Plugin
+	// Detection and configuration used for the build.
+	detection    *packer2llb.Detection
+	pluginConfig *Config
+	// Build arguments supplied by the client.
+	buildArgs map[string]string
 }
 
+// Platform of the worker used by the tests.
+var buildPlatform = &specs.Platform{OS: "linux", Architecture: "amd64"}
+
 func (suite *golangTestSuite) SetupTest() {
 	suite.ctrl = gomock.NewController(suite.T())
 	suite.ctx = context.Background()
 	suite.build = cib_mock.NewMockService(suite.ctrl)
+	suite.build.EXPECT().
+		GetBuildPlatform().
+		Return(buildPlatform).
+		AnyTimes()
+	suite.buildArgs = nil
+	suite.build.EXPECT().
+		GetBuildArgs().
+		DoAndReturn(func() map[string]string { return suite.buildArgs }).
+		AnyTimes()
 	suite.src = cib_mock.NewMockReference(suite.ctrl)
 	suite.plugin = NewPlugin()
+	suite.pluginConfig = &Config{DependencyMode: DMUnknown}
+	suite.detection = &packer2llb.Detection{
+		Plugin: "go",
+		Config: config.New(),
+		Data:   suite.pluginConfig,
+	}
+}
+
+// Contents of go.mod used by the tests.
+const goMod = `
+module github.com/notareal/project
+
+go 1.15
+`
+
+// Sets up the build context with the files provided.
+func (suite *golangTestSuite) setupProject(files map[string]string) {
+	suite.src.EXPECT().
+		ReadDir(suite.ctx, gomock.Any()).
+		DoAndReturn(func(_ context.Context, req client.ReadDirRequest) ([]*fsutil.Stat, error) {
+			entries := make(map[string]*fsutil.Stat)
+			for file := range files {
+				rel := file
+				if req.Path != "." {
+					if !strings.HasPrefix(file, req.Path+"/") {
+						continue
+					}
+					rel = strings.TrimPrefix(file, req.Path+"/")
+				}
+				parts := strings.SplitN(rel, "/", 2)
+				if len(parts) == 1 {
+					entries[parts[0]] = &fsutil.Stat{Path: parts[0]}
+				} else {
+					entries[parts[0]] = &fsutil.Stat{Path: parts[0], Mode: uint32(os.ModeDir)}
+				}
+			}
+			var stats []*fsutil.Stat
+			for _, stat := range entries {
+				stats = append(stats, stat)
+			}
+			sort.Slice(stats, func(i, j int) bool { return stats[i].Path < stats[j].Path })
+			return stats, nil
+		}).
+		AnyTimes()
+	suite.src.EXPECT().
+		ReadFile(suite.ctx, gomock.Any()).
+		DoAndReturn(func(_ context.Context, req client.ReadRequest) ([]byte, error) {
+			data, ok := files[req.Filename]
+			if !ok {
+				return nil, errors.New("not found")
+			}
+			return []byte(data), nil
+		}).
+		AnyTimes()
 }
 
 func (suite *golangTestSuite) TearDownTest() {
 	suite.ctrl.Finish()
 }
 
+func (suite *golangTestSuite) TestSchema() {
+	// Act
+	key, prototype := suite.plugin.Schema()
+
+	// Assert
+	require.Equal(suite.T(), "go", key)
+	require.IsType(suite.T(), Config{}, prototype)
+}
+
 func (suite *golangTestSuite) TestInvalidConfig() {
 	// Arrange
 	cfg := config.New()
@@ -48,10 +131,68 @@ func (suite *golangTestSuite) TestInvalidConfig() {
 	}
 
 	// Act
-	err := suite.plugin.Detect(suite.ctx, suite.src, cfg)
+	_, err := suite.plugin.Detect(suite.ctx, suite.src, cfg)
+
+	// Assert
+	require.NotNil(suite.T(), err)
+}
+
+func (suite *golangTestSuite) TestUnknownConfigKey() {
+	// Arrange
+	cfg, err := config.Read([]byte(`
+go:
+  verison: "1.16"
+`))
+	require.Nil(suite.T(), err)
+
+	// Act
+	_, err = suite.plugin.Detect(suite.ctx, suite.src, cfg)
+
+	// Assert
+	require.NotNil(suite.T(), err)
+	require.Equal(suite.T(), "pack.yaml:3:3: go.verison: unknown key", err.Error())
+}
+
+func (suite *golangTestSuite) TestSSHWithoutKnownHosts() {
+	// Arrange
+	cfg, err := config.Read([]byte(`
+go:
+  private: ["gitlab.example.com/*"]
+  auth:
+    ssh: default
+`))
+	require.Nil(suite.T(), err)
+
+	// Act
+	_, err = suite.plugin.Detect(suite.ctx, suite.src, cfg)
 
 	// Assert
 	require.NotNil(suite.T(), err)
+	require.Equal(
+		suite.T(),
+		"pack.yaml:5:10: go.auth.ssh: knownHosts must be set to verify the host keys of the private repositories",
+		err.Error(),
+	)
+}
+
+func (suite *golangTestSuite) TestConfig() {
+	// Arrange
+	cfg, err := config.Read([]byte(`
+go:
+  cgo: false
+  static: true
+`))
+	require.Nil(suite.T(), err)
+	pluginConfig := &Config{}
+
+	// Act
+	err = cfg.Section("go", pluginConfig)
+
+	// Assert
+	require.Nil(suite.T(), err)
+	require.NotNil(suite.T(), pluginConfig.CGO)
+	require.False(suite.T(), *pluginConfig.CGO)
+	require.True(suite.T(), pluginConfig.Static)
 }
 
 func (suite *golangTestSuite) TestDetectNotFound() {
@@ -65,10 +206,11 @@ func (suite *golangTestSuite) TestDetectNotFound() {
 		Return(files, nil)
 
 	// Act
-	err := suite.plugin.Detect(suite.ctx, suite.src, config.New())
+	detection, err := suite.plugin.Detect(suite.ctx, suite.src, config.New())
 
 	// Assert
 	require.Nil(suite.T(), err)
+	require.Nil(suite.T(), detection)
 }
 
 func (suite *golangTestSuite) TestDetectFoundGoSource() {
@@ -83,10 +225,10 @@ func (suite *golangTestSuite) TestDetectFoundGoSource() {
 	suite.src.EXPECT().
 		ReadFile(suite.ctx, gomock.Any()).
 		Return(nil, errors.New("not found")).
-		Times(2)
+		Times(4)
 
 	// Act
-	err := suite.plugin.Detect(suite.ctx, suite.src, config.New())
+	_, err := suite.plugin.Detect(suite.ctx, suite.src, config.New())
 
 	// Assert
 	require.Same(suite.T(), ErrUnknownDep, err)
@@ -110,7 +252,7 @@ func (suite *golangTestSuite) TestDetectGoModNotFound() {
 	}
 
 	// Act
-	err := suite.plugin.Detect(suite.ctx, suite.src, cfg)
+	_, err := suite.plugin.Detect(suite.ctx, suite.src, cfg)
 
 	// Assert
 	require.NotNil(suite.T(), err)
@@ -119,43 +261,30 @@ func (suite *golangTestSuite) TestDetectGoModNotFound() {
 
 func (suite *golangTestSuite) TestDetectGoModFails() {
 	// Arrange
-	req := client.ReadDirRequest{Path: "."}
-	files := []*fsutil.Stat{
-		{Path: "hello.go"},
-	}
-	suite.src.EXPECT().
-		ReadDir(suite.ctx, req).
-		Return(files, nil)
-	goMod := []byte("\"")
-	suite.src.EXPECT().
-		ReadFile(suite.ctx, gomock.Any()).
-		Return(goMod, nil).
-		Times(3)
+	suite.setupProject(map[string]string{
+		"go.mod":   "\"",
+		"go.sum":   "",
+		"hello.go": "package main",
+	})
 
 	// Act
-	err := suite.plugin.Detect(suite.ctx, suite.src, config.New())
+	_, err := suite.plugin.Detect(suite.ctx, suite.src, config.New())
 
 	// Assert
 	require.NotNil(suite.T(), err)
+	require.Contains(suite.T(), err.Error(), "fail to parse go.mod")
 }
 
 func (suite *golangTestSuite) TestDetectGoModIncomplete() {
 	// Arrange
-	req := client.ReadDirRequest{Path: "."}
-	files := []*fsutil.Stat{
-		{Path: "hello.go"},
-	}
-	suite.src.EXPECT().
-		ReadDir(suite.ctx, req).
-		Return(files, nil)
-	goMod := []byte("")
-	suite.src.EXPECT().
-		ReadFile(suite.ctx, gomock.Any()).
-		Return(goMod, nil).
-		Times(3)
+	suite.setupProject(map[string]string{
+		"go.mod":   "",
+		"go.sum":   "",
+		"hello.go": "package main",
+	})
 
 	// Act
-	err := suite.plugin.Detect(suite.ctx, suite.src, config.New())
+	_, err := suite.plugin.Detect(suite.ctx, suite.src, config.New())
 
 	// Assert
 	require.Same(suite.T(), ErrModIncomplete, err)
@@ -163,22 +292,11 @@ func (suite *golangTestSuite) TestDetectGoModIncomplete() {
 
 func (suite *golangTestSuite) TestDetectGoModSucceeds() {
 	// Arrange
-	req := client.ReadDirRequest{Path: "."}
-	files := []*fsutil.Stat{
-		{Path: "hello.go"},
-	}
-	suite.src.EXPECT().
-		ReadDir(suite.ctx, req).
-		Return(files, nil)
-	goMod := []byte(`
-module github.com/notareal/project
-
-go 1.15
-`)
-	suite.src.EXPECT().
-		ReadFile(suite.ctx, gomock.Any()).
-		Return(goMod, nil).
-		Times(3)
+	suite.setupProject(map[string]string{
+		"go.mod":   goMod,
+		"go.sum":   "",
+		"hello.go": "package main",
+	})
 	tags := []string{"tag1", "tag2"}
 	cfg := config.New()
 	cfg.Other["go"] = map[string]interface{}{
@@ -186,16 +304,226 @@ go 1.15
 	}
 
 	// Act
-	err := suite.plugin.Detect(suite.ctx, suite.src, cfg)
+	detection, err := suite.plugin.Detect(suite.ctx, suite.src, cfg)
+
+	// Assert
+	require.Nil(suite.T(), err)
+	require.Equal(suite.T(), "go", detection.Plugin)
+	require.Equal(suite.T(), packer2llb.ConfidenceHigh, detection.Confidence)
+	require.Equal(suite.T(), "github.com/notareal/project", detection.Project)
+	require.Equal(suite.T(), "1.15", detection.Version)
+	require.Equal(suite.T(), []string{"found go.mod", "found module github.com/notareal/project"}, detection.Reasons)
+	require.Empty(suite.T(), detection.Binaries)
+	require.Same(suite.T(), cfg, detection.Config)
+	require.Equal(suite.T(), tags, detection.Data.(*Config).Tags)
+	require.Empty(suite.T(), detection.Data.(*Config).mains)
+	require.Equal(suite.T(), []string{"."}, detection.Data.(*Config).modDirs)
+}
+
+func (suite *golangTestSuite) TestDetectPackages() {
+	// Arrange
+	suite.setupProject(map[string]string{
+		"go.mod":               goMod,
+		"go.sum":               "",
+		"main.go":              "package main",
+		"cmd/server/main.go":   "package main",
+		"cmd/migrate/main.go":  "// +build ignore\n\npackage main",
+		"cmd/migrate/tool.go":  "package migrate",
+		"cmd/tools/gen/gen.go": "package main",
+		"internal/lib.go":      "package internal",
+	})
+	cfg := config.New()
+	cfg.Other["go"] = map[string]interface{}{
+		"packages": []string{"./cmd/..."},
+		"exclude":  []string{"./cmd/tools/..."},
+	}
+
+	// Act
+	detection, err := suite.plugin.Detect(suite.ctx, suite.src, cfg)
+
+	// Assert
+	require.Nil(suite.T(), err)
+	require.Equal(suite.T(), []string{"server"}, detection.Binaries)
+	require.Equal(suite.T(), []string{"cmd/server"}, detection.Data.(*Config).mains)
+}
+
+func (suite *golangTestSuite) TestDetectPackagesNestedModule() {
+	// Arrange
+	suite.setupProject(map[string]string{
+		"go.mod":                     goMod,
+		"go.sum":                     "",
+		"main.go":                    "package main",
+		"tests/template/go.mod":      "module github.com/notareal/template\n",
+		"tests/template/main.go":     "package main",
+		"tests/template/cmd/main.go": "package main",
+	})
+	cfg := config.New()
+	cfg.Other["go"] = map[string]interface{}{
+		"exclude": []string{"./internal/..."},
+	}
+
+	// Act
+	detection, err := suite.plugin.Detect(suite.ctx, suite.src, cfg)
+
+	// Assert
+	require.Nil(suite.T(), err)
+	require.Equal(suite.T(), []string{"project"}, detection.Binaries)
+	require.Equal(suite.T(), []string{"."}, detection.Data.(*Config).mains)
+}
+
+func (suite *golangTestSuite) TestDetectPackagesNoMain() {
+	// Arrange
+	suite.setupProject(map[string]string{
+		"go.mod":  goMod,
+		"go.sum":  "",
+		"main.go": "package main",
+	})
+	cfg := config.New()
+	cfg.Other["go"] = map[string]interface{}{
+		"packages": []string{"./cmd/..."},
+	}
+
+	// Act
+	_, err := suite.plugin.Detect(suite.ctx, suite.src, cfg)
+
+	// Assert
+	require.Same(suite.T(), ErrNoMain, err)
+}
+
+func (suite *golangTestSuite) TestDetectWorkspace() {
+	// Arrange
+	suite.setupProject(map[string]string{
+		"go.work":                    "go 1.18\n\nuse (\n\t./api\n\t./worker/v2\n)\n",
+		"api/go.mod":                 "module github.com/notareal/api\n\ngo 1.18\n",
+		"api/main.go":                "package main",
+		"worker/v2/go.mod":           "module github.com/notareal/worker/v2\n\ngo 1.18\n",
+		"worker/v2/main.go":          "package main",
+		"worker/v2/cmd/cron/main.go": "package main",
+		"tools/gen/main.go":          "package main",
+	})
+
+	// Act
+	detection, err := suite.plugin.Detect(suite.ctx, suite.src, config.New())
+
+	// Assert
+	require.Nil(suite.T(), err)
+	require.Equal(suite.T(), packer2llb.ConfidenceHigh, detection.Confidence)
+	require.Equal(suite.T(), "github.com/notareal/api", detection.Project)
+	require.Equal(suite.T(), "1.18", detection.Version)
+	require.Contains(suite.T(), detection.Reasons, "found module github.com/notareal/worker/v2")
+	require.Equal(suite.T(), []string{"api", "worker", "cron"}, detection.Binaries)
+	pluginConfig := detection.Data.(*Config)
+	require.Equal(suite.T(), DMWorkspace, string(pluginConfig.DependencyMode))
+	require.Equal(suite.T(), []string{"api", "worker/v2", "worker/v2/cmd/cron"}, pluginConfig.mains)
+	require.Equal(suite.T(), []string{"api", "worker/v2"}, pluginConfig.modDirs)
+}
+
+func (suite *golangTestSuite) TestDetectWorkspaceIncomplete() {
+	// Arrange
+	suite.setupProject(map[string]string{
+		"go.work":  "go 1.18\n",
+		"hello.go": "package main",
+	})
+
+	// Act
+	_, err := suite.plugin.Detect(suite.ctx, suite.src, config.New())
+
+	// Assert
+	require.Same(suite.T(), ErrWorkIncomplete, err)
+}
+
+func (suite *golangTestSuite) TestDetectWorkspaceOutside() {
+	// Arrange
+	suite.setupProject(map[string]string{
+		"go.work":  "go 1.18\n\nuse ../shared\n",
+		"hello.go": "package main",
+	})
+
+	// Act
+	_, err := suite.plugin.Detect(suite.ctx, suite.src, config.New())
+
+	// Assert
+	require.NotNil(suite.T(), err)
+	require.Contains(suite.T(), err.Error(), "outside of the build context")
+}
+
+func (suite *golangTestSuite) TestDetectVendor() {
+	// Arrange
+	suite.setupProject(map[string]string{
+		"go.mod":                    goMod,
+		"main.go":                   "package main",
+		"vendor/modules.txt":        "",
+		"vendor/example.com/lib.go": "package main",
+	})
+
+	// Act
+	detection, err := suite.plugin.Detect(suite.ctx, suite.src, config.New())
+
+	// Assert
+	require.Nil(suite.T(), err)
+	require.Equal(suite.T(), "github.com/notareal/project", detection.Project)
+	require.Equal(suite.T(), "1.15", detection.Version)
+	require.Empty(suite.T(), detection.Binaries)
+	require.Equal(suite.T(), DMVendor, string(detection.Data.(*Config).DependencyMode))
+}
+
+func (suite *golangTestSuite) TestDetectGopath() {
+	// Arrange
+	suite.setupProject(map[string]string{
+		"main.go": "package main",
+	})
+	cfg := config.New()
+	cfg.Other["go"] = map[string]interface{}{
+		"version":        "1.16",
+		"dependencyMode": "gopath",
+		"importPath":     "github.com/notareal/legacy",
+	}
+
+	// Act
+	detection, err := suite.plugin.Detect(suite.ctx, suite.src, cfg)
 
 	// Assert
-	require.Same(suite.T(), packer2llb.ErrActivate, err)
-	require.Equal(suite.T(), tags, suite.plugin.pluginConfig.Tags)
+	require.Nil(suite.T(), err)
+	require.Equal(suite.T(), packer2llb.ConfidenceHigh, detection.Confidence)
+	require.Equal(suite.T(), "github.com/notareal/legacy", detection.Project)
+	require.Equal(suite.T(), "1.16", detection.Version)
+	require.Empty(suite.T(), detection.Binaries)
+}
+
+func (suite *golangTestSuite) TestDetectGopathIncomplete() {
+	// Arrange
+	suite.setupProject(map[string]string{
+		"main.go": "package main",
+	})
+	cfg := config.New()
+	cfg.Other["go"] = map[string]interface{}{
+		"version":        "1.16",
+		"dependencyMode": "gopath",
+	}
+
+	// Act
+	_, err := suite.plugin.Detect(suite.ctx, suite.src, cfg)
+
+	// Assert
+	require.Same(suite.T(), ErrGopathIncomplete, err)
+}
+
+func (suite *golangTestSuite) TestBuildFailsDetection() {
+	// Arrange
+	suite.detection.Data = nil
+	platform := &specs.Platform{OS: "linux", Architecture: "amd64"}
+
+	// Act
+	_, _, err := suite.plugin.Build(suite.ctx, platform, suite.build, suite.detection)
+
+	// Assert
+	require.NotNil(suite.T(), err)
+	require.Contains(suite.T(), err.Error(), "unexpected detection")
 }
 
 func (suite *golangTestSuite) TestBuildFailsFrom1() {
 	// Arrange
-	suite.plugin.pluginConfig.Version = "1.14"
+	suite.pluginConfig.Version = "1.14"
 
 	platform := &specs.Platform{OS: "linux", Architecture: "amd64"}
 	expected := errors.New("something went wrong")
@@ -204,7 +532,7 @@ func (suite *golangTestSuite) TestBuildFailsFrom1() {
 		Return(llb.Scratch(), nil, expected)
 
 	// Act
-	_, _, actual := suite.plugin.Build(suite.ctx, platform, suite.build)
+	_, _, actual := suite.plugin.Build(suite.ctx, platform, suite.build, suite.detection)
 
 	// Assert
 	require.Same(suite.T(), expected, actual)
@@ -212,7 +540,7 @@ func (suite *golangTestSuite) TestBuildFailsFrom1() {
 
 func (suite *golangTestSuite) TestBuildFailsSrc() {
 	// Arrange
-	suite.plugin.pluginConfig.Version = "1.14"
+	suite.pluginConfig.Version = "1.14"
 
 	platform := &specs.Platform{OS: "linux", Architecture: "amd64"}
 	suite.build.EXPECT().
@@ -225,7 +553,7 @@ func (suite *golangTestSuite) TestBuildFailsSrc() {
 		Return(llb.Scratch(), expected)
 
 	// Act
-	_, _, actual := suite.plugin.Build(suite.ctx, platform, suite.build)
+	_, _, actual := suite.plugin.Build(suite.ctx, platform, suite.build, suite.detection)
 
 	// Assert
 	require.Same(suite.T(), expected, actual)
@@ -233,7 +561,8 @@ func (suite *golangTestSuite) TestBuildFailsSrc() {
 
 func (suite *golangTestSuite) TestBuildFailsFrom2() {
 	// Arrange
-	suite.plugin.pluginConfig.Version = "1.14"
+	suite.pluginConfig.Version = "1.14"
+	suite.pluginConfig.Runtime = RTBase
 
 	platform := &specs.Platform{OS: "linux", Architecture: "amd64"}
 	suite.build.EXPECT().
@@ -249,7 +578,7 @@ func (suite *golangTestSuite) TestBuildFailsFrom2() {
 		Return(llb.Scratch(), nil, expected)
 
 	// Act
-	_, _, actual := suite.plugin.Build(suite.ctx, platform, suite.build)
+	_, _, actual := suite.plugin.Build(suite.ctx, platform, suite.build, suite.detection)
 
 	// Assert
 	require.Same(suite.T(), expected, actual)
@@ -257,10 +586,11 @@ func (suite *golangTestSuite) TestBuildFailsFrom2() {
 
 func (suite *golangTestSuite) TestBuildSucceeds() {
 	// Arrange
-	suite.plugin.config.Debug = false
-	suite.plugin.pluginConfig.DependencyMode = DMGoMod
-	suite.plugin.pluginConfig.Version = "1.14"
-	suite.plugin.pluginConfig.Tags = []string{"tag1", "tag2"}
+	suite.detection.Config.Debug = false
+	suite.pluginConfig.DependencyMode = DMGoMod
+	suite.pluginConfig.Version = "1.14"
+	suite.pluginConfig.Tags = []string{"tag1", "tag2"}
+	suite.pluginConfig.Runtime = RTBase
 
 	platform := &specs.Platform{OS: "linux", Architecture: "amd64"}
 	suite.build.EXPECT().
@@ -275,7 +605,7 @@ func (suite *golangTestSuite) TestBuildSucceeds() {
 		Return(llb.Scratch(), expected, nil)
 
 	// Act
-	state, actual, err := suite.plugin.Build(suite.ctx, platform, suite.build)
+	state, actual, err := suite.plugin.Build(suite.ctx, platform, suite.build, suite.detection)
 
 	// Assert
 	require.Nil(suite.T(), err)
@@ -283,6 +613,165 @@ func (suite *golangTestSuite) TestBuildSucceeds() {
 	require.Same(suite.T(), expected, actual)
 }
 
+func (suite *golangTestSuite) TestBuildArtifactsFailsFrom() {
+	// Arrange
+	suite.pluginConfig.Version = "1.14"
+
+	platform := &specs.Platform{OS: "linux", Architecture: "amd64"}
+	expected := errors.New("something went wrong")
+	suite.build.EXPECT().
+		From("golang:1.14", platform, gomock.Any()).
+		Return(llb.Scratch(), nil, expected)
+
+	// Act
+	_, actual := suite.plugin.BuildArtifacts(suite.ctx, platform, suite.build, suite.detection)
+
+	// Assert
+	require.Same(suite.T(), expected, actual)
+}
+
+func (suite *golangTestSuite) TestBuildPackages() {
+	// Arrange
+	suite.pluginConfig.Version = "1.14"
+	suite.pluginConfig.mains = []string{".", "cmd/server"}
+
+	platform := &specs.Platform{OS: "linux", Architecture: "amd64"}
+	suite.build.EXPECT().
+		From("golang:1.14", platform, gomock.Any()).
+		Return(llb.Scratch(), nil, nil)
+	suite.build.EXPECT().
+		SrcState().
+		Return(llb.Scratch(), nil)
+
+	// Act
+	state, err := suite.plugin.BuildArtifacts(suite.ctx, platform, suite.build, suite.detection)
+
+	// Assert
+	require.Nil(suite.T(), err)
+	require.True(suite.T(), suite.contains(state, "./cmd/server"))
+	require.False(suite.T(), suite.contains(state, "./..."))
+}
+
+func (suite *golangTestSuite) TestBuildArtifactsSucceeds() {
+	// Arrange
+	suite.pluginConfig.DependencyMode = DMGoMod
+	suite.pluginConfig.Version = "1.14"
+
+	platform := &specs.Platform{OS: "linux", Architecture: "amd64"}
+	suite.build.EXPECT().
+		From("golang:1.14", platform, gomock.Any()).
+		Return(llb.Scratch(), nil, nil)
+	suite.build.EXPECT().
+		SrcState().
+		Return(llb.Scratch(), nil)
+
+	// Act
+	state, err := suite.plugin.BuildArtifacts(suite.ctx, platform, suite.build, suite.detection)
+
+	// Assert
+	require.Nil(suite.T(), err)
+	require.NotNil(suite.T(), state)
+}
+
+func (suite *golangTestSuite) TestBuildArtifactsCrossCompiles() {
+	// Arrange
+	suite.pluginConfig.Version = "1.14"
+
+	platform := &specs.Platform{OS: "linux", Architecture: "arm", Variant: "v7"}
+	suite.build.EXPECT().
+		From("golang:1.14", buildPlatform, gomock.Any()).
+		Return(llb.Scratch(), nil, nil)
+	suite.build.EXPECT().
+		SrcState().
+		Return(llb.Scratch(), nil)
+
+	// Act
+	state, err := suite.plugin.BuildArtifacts(suite.ctx, platform, suite.build, suite.detection)
+
+	// Assert
+	require.Nil(suite.T(), err)
+	require.True(suite.T(), suite.contains(state, "GOOS=linux"))
+	require.True(suite.T(), suite.contains(state, "GOARCH=arm"))
+	require.True(suite.T(), suite.contains(state, "GOARM=7"))
+}
+
+func (suite *golangTestSuite) TestBuildArtifactsCGOEmulated() {
+	// Arrange
+	enabled := true
+	suite.pluginConfig.Version = "1.14"
+	suite.pluginConfig.CGO = &enabled
+
+	platform := &specs.Platform{OS: "linux", Architecture: "arm64"}
+	suite.build.EXPECT().
+		From("golang:1.14", platform, gomock.Any()).
+		Return(llb.Scratch(), nil, nil)
+	suite.build.EXPECT().
+		SrcState().
+		Return(llb.Scratch(), nil)
+
+	// Act
+	state, err := suite.plugin.BuildArtifacts(suite.ctx, platform, suite.build, suite.detection)
+
+	// Assert
+	require.Nil(suite.T(), err)
+	require.False(suite.T(), suite.contains(state, "GOARCH="))
+}
+
+func (suite *golangTestSuite) TestBuildArtifactsVendor() {
+	// Arrange
+	suite.pluginConfig.DependencyMode = DMVendor
+	suite.pluginConfig.Version = "1.14"
+
+	platform := &specs.Platform{OS: "linux", Architecture: "amd64"}
+	suite.build.EXPECT().
+		From("golang:1.14", platform, gomock.Any()).
+		Return(llb.Scratch(), nil, nil)
+	suite.build.EXPECT().
+		SrcState().
+		Return(llb.Scratch(), nil)
+
+	// Act
+	state, err := suite.plugin.BuildArtifacts(suite.ctx, platform, suite.build, suite.detection)
+
+	// Assert
+	require.Nil(suite.T(), err)
+	require.True(suite.T(), suite.contains(state, "-mod=vendor"))
+	require.False(suite.T(), suite.contains(state, dirModFiles))
+}
+
+func (suite *golangTestSuite) TestBuildArtifactsGopath() {
+	// Arrange
+	suite.pluginConfig.DependencyMode = DMGopath
+	suite.pluginConfig.Version = "1.16"
+	suite.pluginConfig.ImportPath = "github.com/notareal/legacy"
+
+	platform := &specs.Platform{OS: "linux", Architecture: "amd64"}
+	suite.build.EXPECT().
+		From("golang:1.16", platform, gomock.Any()).
+		Return(llb.Scratch(), nil, nil)
+	suite.build.EXPECT().
+		SrcState().
+		Return(llb.Scratch(), nil)
+
+	// Act
+	state, err := suite.plugin.BuildArtifacts(suite.ctx, platform, suite.build, suite.detection)
+
+	// Assert
+	require.Nil(suite.T(), err)
+	require.True(suite.T(), suite.contains(state, "/go/src/github.com/notareal/legacy"))
+	require.True(suite.T(), suite.contains(state, "GO111MODULE=off"))
+	require.False(suite.T(), suite.contains(state, dirModFiles))
+}
+
+func TestCGOEnabled(t *testing.T) {
+	enabled, disabled := true, false
+	require.Equal(t, "", cgoEnabled(&Config{}))
+	require.Equal(t, "0", cgoEnabled(&Config{Static: true}))
+	require.Equal(t, "1", cgoEnabled(&Config{CGO: &enabled}))
+	require.Equal(t, "1", cgoEnabled(&Config{CGO: &enabled, Static: true}))
+	require.Equal(t, "0", cgoEnabled(&Config{CGO: &disabled}))
+}
+
 func TestGolangPlugin(t *testing.T) {
 	suite.Run(t, new(golangTestSuite))
 }
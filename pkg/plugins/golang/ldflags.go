@@ -0,0 +1,168 @@
+package golang
+
+import (
+	"bytes"
+	"context"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/EricHripko/buildkit-fdk/pkg/cib"
+	"github.com/moby/buildkit/client/llb"
+	"github.com/moby/buildkit/frontend/gateway/client"
+	"github.com/pkg/errors"
+)
+
+const (
+	// Frontend option with the revision of the build context (set by the
+	// clients that build from a repository).
+	keyRevision = "vcs:revision"
+	// Build argument that pins the build date for reproducible builds.
+	argSourceDateEpoch = "SOURCE_DATE_EPOCH"
+	// Directory where the version control metadata is written.
+	dirVCS = "/vcs"
+)
+
+// Script that collects the version control metadata of the sources. Each of
+// the commands may fail (e.g., when there are no tags).
+const scriptVCS = `git="git --no-optional-locks -c safe.directory=*"
+$git rev-parse HEAD > ` + dirVCS + `/commit 2>/dev/null
+$git describe --tags --exact-match HEAD > ` + dirVCS + `/tag 2>/dev/null
+$git status --porcelain --untracked-files=no > ` + dirVCS + `/status 2>/dev/null
+true`
+
+// LDFlagsVars are the variables available in the templates of go.ldflags
+// (e.g., -X main.version={{.Version}}).
+type LDFlagsVars struct {
+	// Commit that the sources were built from.
+	Commit string
+	// Abbreviated commit that the sources were built from.
+	ShortCommit string
+	// Tag pointing at the commit (if any).
+	Tag string
+	// Whether the tracked files have uncommitted changes (files missing
+	// from the build context don't count).
+	Dirty bool
+	// Version of the sources: the tag (or abbreviated commit if not tagged)
+	// with -dirty suffix for uncommitted changes.
+	Version string
+	// Build date in RFC 3339 format (honours SOURCE_DATE_EPOCH).
+	Date string
+	// Build arguments.
+	Args map[string]string
+}
+
+// Renders the flags for the linker from the templates.
+func renderLDFlags(flags []string, vars *LDFlagsVars) (string, error) {
+	var buf bytes.Buffer
+	for i, flag := range flags {
+		tmpl, err := template.New("ldflags").Option("missingkey=zero").Parse(flag)
+		if err != nil {
+			return "", errors.Wrap(err, "golang: invalid ldflags")
+		}
+		if i > 0 {
+			buf.WriteByte(' ')
+		}
+		if err := tmpl.Execute(&buf, vars); err != nil {
+			return "", errors.Wrap(err, "golang: invalid ldflags")
+		}
+	}
+	return buf.String(), nil
+}
+
+// Collects the variables for the templates of go.ldflags. Version control
+// metadata is read from the .git directory of the build context, falling
+// back to the revision supplied by the client.
+func (p *Plugin) ldflagsVars(ctx context.Context, build cib.Service, state llb.State) (*LDFlagsVars, error) {
+	args := build.GetBuildArgs()
+	vars := &LDFlagsVars{
+		Commit: build.GetOpts()[keyRevision],
+		Date:   time.Now().UTC().Format(time.RFC3339),
+		Args:   args,
+	}
+	if epoch, ok := args[argSourceDateEpoch]; ok {
+		seconds, err := strconv.ParseInt(epoch, 10, 64)
+		if err != nil {
+			return nil, errors.Errorf("golang: invalid %s %q", argSourceDateEpoch, epoch)
+		}
+		vars.Date = time.Unix(seconds, 0).UTC().Format(time.RFC3339)
+	}
+
+	// Version control metadata
+	src, err := build.Src()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := src.StatFile(ctx, client.StatRequest{Path: ".git"}); err == nil {
+		if err := p.readVCS(ctx, build, state, vars); err != nil {
+			return nil, err
+		}
+	}
+
+	vars.ShortCommit = vars.Commit
+	if len(vars.ShortCommit) > 7 {
+		vars.ShortCommit = vars.ShortCommit[:7]
+	}
+	vars.Version = vars.Tag
+	if vars.Version == "" {
+		vars.Version = vars.ShortCommit
+	}
+	if vars.Dirty {
+		vars.Version += "-dirty"
+	}
+	return vars, nil
+}
+
+// Runs git on the sources to read the version control metadata.
+func (p *Plugin) readVCS(ctx context.Context, build cib.Service, state llb.State, vars *LDFlagsVars) error {
+	src, err := build.SrcState()
+	if err != nil {
+		return err
+	}
+	out := state.Run(
+		llb.AddMount(dirSrc, src, llb.Readonly),
+		llb.Dir(dirSrc),
+		llb.Args([]string{"/bin/sh", "-c", scriptVCS}),
+		llb.WithCustomName("Read version control metadata"),
+	).AddMount(dirVCS, llb.Scratch())
+	ref, err := build.Solve(ctx, out)
+	if err != nil {
+		return err
+	}
+
+	read := func(name string) (string, error) {
+		data, err := ref.ReadFile(ctx, client.ReadRequest{Filename: name})
+		// Leading spaces are significant in the status (e.g., " M main.go")
+		return strings.TrimRight(string(data), "\n"), err
+	}
+	commit, err := read("commit")
+	if err != nil {
+		return err
+	}
+	if commit != "" {
+		vars.Commit = commit
+	}
+	if vars.Tag, err = read("tag"); err != nil {
+		return err
+	}
+	status, err := read("status")
+	if err != nil {
+		return err
+	}
+	vars.Dirty = isDirty(status)
+	return nil
+}
+
+// Checks whether the output of git status --porcelain has changes. Files
+// deleted from the working tree are ignored, since the files excluded by
+// .dockerignore are missing from the build context.
+func isDirty(status string) bool {
+	for _, line := range strings.Split(status, "\n") {
+		if line == "" || strings.HasPrefix(line, " D ") {
+			continue
+		}
+		return true
+	}
+	return false
+}
@@ -0,0 +1,181 @@
+package golang
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	cib_mock "github.com/EricHripko/buildkit-fdk/pkg/cib/mock"
+	"github.com/golang/mock/gomock"
+	"github.com/moby/buildkit/client/llb"
+	"github.com/moby/buildkit/frontend/gateway/client"
+	specs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/require"
+	fsutil "github.com/tonistiigi/fsutil/types"
+)
+
+func TestRenderLDFlags(t *testing.T) {
+	// Arrange
+	flags := []string{
+		"-s",
+		"-X main.version={{.Version}}",
+		"-X main.mode={{.Args.MODE}}",
+		"-X main.missing={{.Args.MISSING}}",
+	}
+	vars := &LDFlagsVars{
+		Version: "v1.0.0",
+		Args:    map[string]string{"MODE": "release"},
+	}
+
+	// Act
+	actual, err := renderLDFlags(flags, vars)
+
+	// Assert
+	require.Nil(t, err)
+	require.Equal(t, "-s -X main.version=v1.0.0 -X main.mode=release -X main.missing=", actual)
+}
+
+func TestRenderLDFlagsInvalid(t *testing.T) {
+	// Act
+	_, err := renderLDFlags([]string{"-X main.version={{.Version"}, &LDFlagsVars{})
+
+	// Assert
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "invalid ldflags")
+}
+
+// Sets up the build arguments and options for the variables.
+func (suite *golangTestSuite) setupVars(args map[string]string, opts map[string]string) {
+	suite.buildArgs = args
+	suite.build.EXPECT().
+		GetOpts().
+		Return(opts)
+}
+
+func (suite *golangTestSuite) TestLDFlagsVarsClient() {
+	// Arrange
+	suite.setupVars(
+		map[string]string{"SOURCE_DATE_EPOCH": "0"},
+		map[string]string{"vcs:revision": "0123456789abcdef"},
+	)
+	suite.build.EXPECT().
+		Src().
+		Return(suite.src, nil)
+	suite.src.EXPECT().
+		StatFile(suite.ctx, client.StatRequest{Path: ".git"}).
+		Return(nil, errors.New("not found"))
+
+	// Act
+	vars, err := suite.plugin.ldflagsVars(suite.ctx, suite.build, llb.Scratch())
+
+	// Assert
+	require.Nil(suite.T(), err)
+	require.Equal(suite.T(), "0123456789abcdef", vars.Commit)
+	require.Equal(suite.T(), "0123456", vars.ShortCommit)
+	require.Equal(suite.T(), "0123456", vars.Version)
+	require.Equal(suite.T(), "1970-01-01T00:00:00Z", vars.Date)
+}
+
+func (suite *golangTestSuite) TestLDFlagsVarsInvalidEpoch() {
+	// Arrange
+	suite.setupVars(
+		map[string]string{"SOURCE_DATE_EPOCH": "yesterday"},
+		map[string]string{},
+	)
+
+	// Act
+	_, err := suite.plugin.ldflagsVars(suite.ctx, suite.build, llb.Scratch())
+
+	// Assert
+	require.NotNil(suite.T(), err)
+	require.Contains(suite.T(), err.Error(), "invalid SOURCE_DATE_EPOCH")
+}
+
+// Sets up the version control metadata read from the sources.
+func (suite *golangTestSuite) setupGit(files map[string]string) {
+	suite.setupVars(map[string]string{}, map[string]string{})
+	suite.build.EXPECT().
+		Src().
+		Return(suite.src, nil)
+	suite.src.EXPECT().
+		StatFile(suite.ctx, client.StatRequest{Path: ".git"}).
+		Return(&fsutil.Stat{Path: ".git"}, nil)
+	suite.build.EXPECT().
+		SrcState().
+		Return(llb.Scratch(), nil)
+	ref := cib_mock.NewMockReference(suite.ctrl)
+	suite.build.EXPECT().
+		Solve(suite.ctx, gomock.Any()).
+		Return(ref, nil)
+	ref.EXPECT().
+		ReadFile(suite.ctx, gomock.Any()).
+		DoAndReturn(func(_ context.Context, req client.ReadRequest) ([]byte, error) {
+			return []byte(files[req.Filename]), nil
+		}).
+		Times(3)
+}
+
+func (suite *golangTestSuite) TestLDFlagsVarsGit() {
+	// Arrange
+	suite.setupGit(map[string]string{
+		"commit": "fedcba9876543210\n",
+		"tag":    "v1.0.0\n",
+		"status": " M main.go\n",
+	})
+
+	// Act
+	vars, err := suite.plugin.ldflagsVars(suite.ctx, suite.build, llb.Scratch())
+
+	// Assert
+	require.Nil(suite.T(), err)
+	require.Equal(suite.T(), "fedcba9876543210", vars.Commit)
+	require.Equal(suite.T(), "v1.0.0", vars.Tag)
+	require.True(suite.T(), vars.Dirty)
+	require.Equal(suite.T(), "v1.0.0-dirty", vars.Version)
+}
+
+func (suite *golangTestSuite) TestLDFlagsVarsGitIgnored() {
+	// Arrange
+	suite.setupGit(map[string]string{
+		"commit": "fedcba9876543210\n",
+		"tag":    "v1.0.0\n",
+		"status": " D README.md\n D docs/index.md\n",
+	})
+
+	// Act
+	vars, err := suite.plugin.ldflagsVars(suite.ctx, suite.build, llb.Scratch())
+
+	// Assert
+	require.Nil(suite.T(), err)
+	require.False(suite.T(), vars.Dirty)
+	require.Equal(suite.T(), "v1.0.0", vars.Version)
+}
+
+func (suite *golangTestSuite) TestBuildLDFlags() {
+	// Arrange
+	suite.pluginConfig.Version = "1.14"
+	suite.pluginConfig.Static = true
+	suite.pluginConfig.LDFlags = []string{"-X main.commit={{.Commit}}"}
+
+	platform := &specs.Platform{OS: "linux", Architecture: "amd64"}
+	suite.build.EXPECT().
+		From("golang:1.14", platform, gomock.Any()).
+		Return(llb.Scratch(), nil, nil)
+	suite.build.EXPECT().
+		SrcState().
+		Return(llb.Scratch(), nil)
+	suite.setupVars(map[string]string{}, map[string]string{"vcs:revision": "abc"})
+	suite.build.EXPECT().
+		Src().
+		Return(suite.src, nil)
+	suite.src.EXPECT().
+		StatFile(suite.ctx, gomock.Any()).
+		Return(nil, errors.New("not found"))
+
+	// Act
+	state, err := suite.plugin.BuildArtifacts(suite.ctx, platform, suite.build, suite.detection)
+
+	// Assert
+	require.Nil(suite.T(), err)
+	require.True(suite.T(), suite.contains(state, "-X main.commit=abc -extldflags -static"))
+}
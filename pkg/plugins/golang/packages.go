@@ -0,0 +1,175 @@
+package golang
+
+import (
+	"context"
+	"go/parser"
+	"go/token"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/EricHripko/buildkit-fdk/pkg/cib"
+	"github.com/moby/buildkit/frontend/gateway/client"
+	"github.com/pkg/errors"
+	fsutil "github.com/tonistiigi/fsutil/types"
+)
+
+// Package pattern that matches all the packages in the project.
+const allPackages = "./..."
+
+// Regular expression for a build constraint that excludes the file from the
+// build (e.g., // +build ignore for code generators).
+var ignoreRegex = regexp.MustCompile(`^//(?:go:build| \+build) .*\bignore\b`)
+
+// Regular expression for a major version suffix of a module path.
+var majorRegex = regexp.MustCompile(`^v[0-9]+$`)
+
+// Finds the main packages in the project (as directories relative to the
+// root) that match the package patterns and don't match the exclusions.
+// Packages of the nested modules that aren't among the module directories
+// are skipped as the go tool doesn't build them (nil if the project isn't
+// built in module mode).
+func findMains(ctx context.Context, src client.Reference, packages []string, exclude []string, modules []string) ([]string, error) {
+	// Group the Go files by directory
+	dirs := make(map[string][]string)
+	var nested []string
+	err := cib.WalkRecursive(ctx, src, func(file *fsutil.Stat) error {
+		if os.FileMode(file.Mode).IsDir() {
+			return nil
+		}
+		if path.Base(file.Path) == "go.mod" {
+			nested = append(nested, path.Dir(file.Path))
+		}
+		if !isBuildable(file.Path) {
+			return nil
+		}
+		dir := path.Dir(file.Path)
+		dirs[dir] = append(dirs[dir], file.Path)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var mains []string
+	for dir, files := range dirs {
+		if !matchAny(packages, dir) || matchAny(exclude, dir) {
+			continue
+		}
+		if modules != nil && !inModules(modules, nested, dir) {
+			continue
+		}
+		sort.Strings(files)
+		for _, file := range files {
+			name, err := packageName(ctx, src, file)
+			if err != nil {
+				return nil, err
+			}
+			if name == "" {
+				continue
+			}
+			if name == "main" {
+				mains = append(mains, dir)
+			}
+			break
+		}
+	}
+	sort.Strings(mains)
+	return mains, nil
+}
+
+// Checks whether the module that contains the directory (the nearest parent
+// with a go.mod file) is one of the modules that are built.
+func inModules(modules []string, nested []string, dir string) bool {
+	module := ""
+	for _, candidate := range nested {
+		if candidate != "." && dir != candidate && !strings.HasPrefix(dir, candidate+"/") {
+			continue
+		}
+		if module == "" || len(candidate) > len(module) {
+			module = candidate
+		}
+	}
+	if module == "" {
+		// Not in a module (e.g., outside of the workspace modules)
+		return true
+	}
+	for _, existing := range modules {
+		if existing == module {
+			return true
+		}
+	}
+	return false
+}
+
+// Checks whether the file is a Go source file that the go tool builds (i.e.,
+// not a test and not in a directory ignored by the go tool).
+func isBuildable(file string) bool {
+	if !strings.HasSuffix(file, ".go") || strings.HasSuffix(file, "_test.go") {
+		return false
+	}
+	for _, elem := range strings.Split(file, "/") {
+		if elem == "vendor" || elem == "testdata" ||
+			strings.HasPrefix(elem, ".") || strings.HasPrefix(elem, "_") {
+			return false
+		}
+	}
+	return true
+}
+
+// Reads the name of the package that the file belongs to (empty if the file
+// is excluded from the build).
+func packageName(ctx context.Context, src client.Reference, file string) (string, error) {
+	data, err := src.ReadFile(ctx, client.ReadRequest{Filename: file})
+	if err != nil {
+		return "", errors.Wrapf(err, "fail to read %s", file)
+	}
+	f, err := parser.ParseFile(token.NewFileSet(), file, data, parser.PackageClauseOnly|parser.ParseComments)
+	if err != nil {
+		return "", errors.Wrapf(err, "fail to parse %s", file)
+	}
+	for _, group := range f.Comments {
+		for _, comment := range group.List {
+			if ignoreRegex.MatchString(comment.Text) {
+				return "", nil
+			}
+		}
+	}
+	return f.Name.Name, nil
+}
+
+// Checks whether the directory matches any of the package patterns.
+func matchAny(patterns []string, dir string) bool {
+	for _, pattern := range patterns {
+		if matchPattern(pattern, dir) {
+			return true
+		}
+	}
+	return false
+}
+
+// Checks whether the directory matches the package pattern (e.g., ./cmd/...
+// matches cmd/app).
+func matchPattern(pattern string, dir string) bool {
+	pattern = path.Clean(pattern)
+	if pattern == "..." {
+		return true
+	}
+	if prefix := strings.TrimSuffix(pattern, "/..."); prefix != pattern {
+		return prefix == "." || dir == prefix || strings.HasPrefix(dir, prefix+"/")
+	}
+	return dir == pattern
+}
+
+// Returns the name of the binary that go install produces for the main
+// package in the directory.
+func binaryName(module string, dir string) string {
+	importPath := path.Join(module, dir)
+	name := path.Base(importPath)
+	if dir == "." && majorRegex.MatchString(name) {
+		name = path.Base(path.Dir(importPath))
+	}
+	return name
+}
@@ -0,0 +1,37 @@
+package golang
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsBuildable(t *testing.T) {
+	require.True(t, isBuildable("main.go"))
+	require.True(t, isBuildable("cmd/app/main.go"))
+	require.False(t, isBuildable("main_test.go"))
+	require.False(t, isBuildable("README.md"))
+	require.False(t, isBuildable("vendor/github.com/pkg/errors/errors.go"))
+	require.False(t, isBuildable("internal/testdata/main.go"))
+	require.False(t, isBuildable("_examples/main.go"))
+	require.False(t, isBuildable(".github/main.go"))
+}
+
+func TestMatchPattern(t *testing.T) {
+	require.True(t, matchPattern("./...", "."))
+	require.True(t, matchPattern("./...", "cmd/app"))
+	require.True(t, matchPattern(".", "."))
+	require.False(t, matchPattern(".", "cmd/app"))
+	require.True(t, matchPattern("./cmd/...", "cmd"))
+	require.True(t, matchPattern("./cmd/...", "cmd/app"))
+	require.False(t, matchPattern("./cmd/...", "cmdline"))
+	require.True(t, matchPattern("./cmd/app", "cmd/app"))
+	require.True(t, matchPattern("cmd/app/", "cmd/app"))
+	require.False(t, matchPattern("./cmd/app", "cmd/app/sub"))
+}
+
+func TestBinaryName(t *testing.T) {
+	require.Equal(t, "project", binaryName("github.com/notareal/project", "."))
+	require.Equal(t, "project", binaryName("github.com/notareal/project/v2", "."))
+	require.Equal(t, "server", binaryName("github.com/notareal/project/v2", "cmd/server"))
+}
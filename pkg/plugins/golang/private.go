@@ -0,0 +1,116 @@
+package golang
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/moby/buildkit/client/llb"
+)
+
+const (
+	// Location of the .netrc file (the golang image runs as root).
+	fileNetrc = "/root/.netrc"
+	// Location of the token for accessing the private repositories.
+	fileToken = "/run/secrets/go-token"
+	// Location of the git configuration for accessing the private
+	// repositories.
+	fileGitConfig = "/etc/gitconfig"
+	// Location of the known host keys of the private repositories.
+	fileKnownHosts = "/run/secrets/go-known-hosts"
+	// Command used by git to connect to the private repositories over SSH.
+	// The host keys are always verified, so the connection fails unless
+	// they're known (e.g., provided with the known_hosts secret).
+	sshCommand = "ssh -o StrictHostKeyChecking=yes"
+)
+
+// AuthConfig describes the credentials for downloading the private modules.
+// The credentials are forwarded by the client (e.g., docker build --ssh
+// default --secret id=netrc,src=$HOME/.netrc) and are only mounted while
+// the go commands run.
+type AuthConfig struct {
+	// ID of the SSH agent socket (e.g., default). The private repositories
+	// are accessed over SSH instead of HTTPS.
+	SSH string `mapstructure:"ssh"`
+	// ID of the secret with a .netrc file.
+	Netrc string
+	// ID of the secret with a token for accessing the private repositories
+	// over HTTPS.
+	Token string
+	// ID of the secret with a known_hosts file that the host keys of the
+	// private repositories are verified against when accessed over SSH
+	// (required with SSH).
+	KnownHosts string
+}
+
+// Returns the options that give the go commands access to the private
+// modules.
+func privateOpts(pluginConfig *Config) []llb.RunOption {
+	var run []llb.RunOption
+	if len(pluginConfig.Private) > 0 {
+		run = append(run, llb.AddEnv("GOPRIVATE", strings.Join(pluginConfig.Private, ",")))
+	}
+	auth := pluginConfig.Auth
+	if auth.SSH != "" {
+		command := sshCommand
+		if auth.KnownHosts != "" {
+			command += " -o UserKnownHostsFile=" + fileKnownHosts
+			run = append(run, llb.AddSecret(fileKnownHosts, llb.SecretID(auth.KnownHosts)))
+		}
+		run = append(run,
+			llb.AddSSHSocket(llb.SSHID(auth.SSH)),
+			llb.AddEnv("GIT_SSH_COMMAND", command),
+		)
+	}
+	if auth.Netrc != "" {
+		run = append(run, llb.AddSecret(fileNetrc, llb.SecretID(auth.Netrc)))
+	}
+	if auth.Token != "" {
+		run = append(run, llb.AddSecret(fileToken, llb.SecretID(auth.Token)))
+	}
+	if config := gitConfig(pluginConfig); config != "" {
+		file := llb.Scratch().File(
+			llb.Mkfile("/gitconfig", 0644, []byte(config)),
+			llb.WithCustomName("Configure access to private modules"),
+		)
+		run = append(run, llb.AddMount(fileGitConfig, file, llb.SourcePath("/gitconfig"), llb.Readonly))
+	}
+	return run
+}
+
+// Returns the git configuration that routes the private repositories over
+// SSH or authenticates them with the token. The configuration itself never
+// contains the credentials.
+func gitConfig(pluginConfig *Config) string {
+	var config strings.Builder
+	for _, host := range privateHosts(pluginConfig.Private) {
+		if pluginConfig.Auth.SSH != "" {
+			fmt.Fprintf(&config, "[url \"ssh://git@%s/\"]\n\tinsteadOf = https://%s/\n", host, host)
+		}
+		if pluginConfig.Auth.Token != "" {
+			fmt.Fprintf(
+				&config,
+				"[credential \"https://%s\"]\n\thelper = \"!f() { echo username=oauth2; echo password=$(cat %s); }; f\"\n",
+				host,
+				fileToken,
+			)
+		}
+	}
+	return config.String()
+}
+
+// Returns the hosts of the private module patterns (e.g., gitlab.example.com
+// for gitlab.example.com/team/*). Patterns with a wildcard in the host are
+// skipped.
+func privateHosts(patterns []string) []string {
+	var hosts []string
+	seen := make(map[string]bool)
+	for _, pattern := range patterns {
+		host := strings.SplitN(pattern, "/", 2)[0]
+		if host == "" || strings.ContainsAny(host, "*?[") || seen[host] {
+			continue
+		}
+		seen[host] = true
+		hosts = append(hosts, host)
+	}
+	return hosts
+}
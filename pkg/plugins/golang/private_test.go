@@ -0,0 +1,106 @@
+package golang
+
+import (
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/moby/buildkit/client/llb"
+	specs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrivateHosts(t *testing.T) {
+	// Arrange
+	patterns := []string{
+		"gitlab.example.com/team/*",
+		"gitlab.example.com/other",
+		"*.corp.example.com",
+		"github.com/example",
+	}
+
+	// Act
+	hosts := privateHosts(patterns)
+
+	// Assert
+	require.Equal(t, []string{"gitlab.example.com", "github.com"}, hosts)
+}
+
+func TestGitConfig(t *testing.T) {
+	// Arrange
+	pluginConfig := &Config{
+		Private: []string{"gitlab.example.com/team/*"},
+		Auth:    AuthConfig{SSH: "default", Token: "gitlab"},
+	}
+
+	// Act
+	config := gitConfig(pluginConfig)
+
+	// Assert
+	require.Contains(t, config, "[url \"ssh://git@gitlab.example.com/\"]\n\tinsteadOf = https://gitlab.example.com/\n")
+	require.Contains(t, config, "[credential \"https://gitlab.example.com\"]\n")
+	require.Contains(t, config, "$(cat /run/secrets/go-token)")
+	require.NotContains(t, config, "gitlab\n")
+}
+
+func TestGitConfigEmpty(t *testing.T) {
+	// Arrange
+	pluginConfig := &Config{Private: []string{"gitlab.example.com/team/*"}}
+
+	// Act
+	config := gitConfig(pluginConfig)
+
+	// Assert
+	require.Empty(t, config)
+}
+
+func (suite *golangTestSuite) TestBuildArtifactsPrivate() {
+	// Arrange
+	suite.pluginConfig.DependencyMode = DMGoMod
+	suite.pluginConfig.Version = "1.14"
+	suite.pluginConfig.Private = []string{"gitlab.example.com/*", "example.org/lib"}
+	suite.pluginConfig.Auth = AuthConfig{SSH: "default", Netrc: "netrc"}
+
+	platform := &specs.Platform{OS: "linux", Architecture: "amd64"}
+	suite.build.EXPECT().
+		From("golang:1.14", platform, gomock.Any()).
+		Return(llb.Scratch(), nil, nil)
+	suite.build.EXPECT().
+		SrcState().
+		Return(llb.Scratch(), nil)
+
+	// Act
+	state, err := suite.plugin.BuildArtifacts(suite.ctx, platform, suite.build, suite.detection)
+
+	// Assert
+	require.Nil(suite.T(), err)
+	require.True(suite.T(), suite.contains(state, "GOPRIVATE=gitlab.example.com/*,example.org/lib"))
+	require.True(suite.T(), suite.contains(state, "GIT_SSH_COMMAND"))
+	require.True(suite.T(), suite.contains(state, fileNetrc))
+	require.True(suite.T(), suite.contains(state, fileGitConfig))
+	require.True(suite.T(), suite.contains(state, "StrictHostKeyChecking=yes"))
+	require.False(suite.T(), suite.contains(state, fileKnownHosts))
+}
+
+func (suite *golangTestSuite) TestBuildArtifactsPrivateKnownHosts() {
+	// Arrange
+	suite.pluginConfig.DependencyMode = DMGoMod
+	suite.pluginConfig.Version = "1.14"
+	suite.pluginConfig.Private = []string{"gitlab.example.com/*"}
+	suite.pluginConfig.Auth = AuthConfig{SSH: "default", KnownHosts: "known_hosts"}
+
+	platform := &specs.Platform{OS: "linux", Architecture: "amd64"}
+	suite.build.EXPECT().
+		From("golang:1.14", platform, gomock.Any()).
+		Return(llb.Scratch(), nil, nil)
+	suite.build.EXPECT().
+		SrcState().
+		Return(llb.Scratch(), nil)
+
+	// Act
+	state, err := suite.plugin.BuildArtifacts(suite.ctx, platform, suite.build, suite.detection)
+
+	// Assert
+	require.Nil(suite.T(), err)
+	require.True(suite.T(), suite.contains(state, "ssh -o StrictHostKeyChecking=yes -o UserKnownHostsFile="+fileKnownHosts))
+	require.True(suite.T(), suite.contains(state, fileKnownHosts))
+}
@@ -0,0 +1,166 @@
+package golang
+
+import (
+	"context"
+	"debug/elf"
+	"fmt"
+	"io"
+	"os"
+	"path"
+
+	"github.com/EricHripko/buildkit-fdk/pkg/cib"
+	"github.com/containerd/containerd/platforms"
+	"github.com/moby/buildkit/client/llb"
+	"github.com/moby/buildkit/frontend/dockerfile/dockerfile2llb"
+	"github.com/moby/buildkit/frontend/gateway/client"
+	"github.com/moby/buildkit/util/system"
+	specs "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+const (
+	// RTStatic represents the distroless image for statically linked
+	// binaries.
+	RTStatic = "static"
+	// RTScratch represents an empty image.
+	RTScratch = "scratch"
+	// RTBase represents the distroless image with glibc.
+	RTBase = "base"
+	// RTCC represents the distroless image with glibc and libstdc++.
+	RTCC = "cc"
+	// RTNonRoot represents the distroless image with glibc that runs as
+	// nonroot user.
+	RTNonRoot = "nonroot"
+)
+
+// Images (along with their debug variants) for the runtimes.
+var runtimeImages = map[string][2]string{
+	RTStatic:  {"gcr.io/distroless/static", "gcr.io/distroless/static:debug"},
+	RTBase:    {"gcr.io/distroless/base", "gcr.io/distroless/base:debug"},
+	RTCC:      {"gcr.io/distroless/cc", "gcr.io/distroless/cc:debug"},
+	RTNonRoot: {"gcr.io/distroless/base:nonroot", "gcr.io/distroless/base:debug-nonroot"},
+}
+
+// Returns the image for the runtime. Runtimes that aren't known are treated
+// as custom image references and used as-is.
+func runtimeImage(runtime string, debug bool) string {
+	images, ok := runtimeImages[runtime]
+	if !ok {
+		return runtime
+	}
+	if debug {
+		return images[1]
+	}
+	return images[0]
+}
+
+// Creates the state for the runtime image.
+func (p *Plugin) runtime(platform *specs.Platform, build cib.Service, runtime string, debug bool) (llb.State, *dockerfile2llb.Image, error) {
+	if runtime == RTScratch {
+		return llb.Scratch(), scratchImage(platform), nil
+	}
+
+	base := runtimeImage(runtime, debug)
+	return build.From(
+		base,
+		platform,
+		fmt.Sprintf("Base runtime image is %s", base),
+	)
+}
+
+// Numeric ID of the nobody user. An empty image has no /etc/passwd, so the
+// user can only be referenced by its ID.
+const uidNobody = "65534"
+
+// Returns the configuration for an empty image.
+func scratchImage(platform *specs.Platform) *dockerfile2llb.Image {
+	p := platforms.DefaultSpec()
+	if platform != nil {
+		p = *platform
+	}
+
+	img := &dockerfile2llb.Image{
+		Image: specs.Image{
+			Architecture: p.Architecture,
+			OS:           p.OS,
+		},
+		Variant: p.Variant,
+	}
+	img.RootFS.Type = "layers"
+	img.Config.WorkingDir = "/"
+	img.Config.User = uidNobody
+	img.Config.Env = []string{"PATH=" + system.DefaultPathEnv(p.OS)}
+	return img
+}
+
+// Returns whether the binaries can run in the runtime without a C library.
+func isStaticRuntime(runtime string) bool {
+	return runtime == RTStatic || runtime == RTScratch
+}
+
+// Inspects the binaries in the build output and returns the first one that
+// is dynamically linked (empty if all of them are statically linked).
+func (p *Plugin) findDynamic(ctx context.Context, build cib.Service, state llb.State) (string, error) {
+	ref, err := build.Solve(ctx, state)
+	if err != nil {
+		return "", err
+	}
+	files, err := ref.ReadDir(ctx, client.ReadDirRequest{Path: dirInstall})
+	if err != nil {
+		return "", err
+	}
+
+	for _, file := range files {
+		if os.FileMode(file.Mode).IsDir() {
+			continue
+		}
+		static, err := isStatic(ctx, ref, path.Join(dirInstall, file.Path))
+		if err != nil {
+			return "", err
+		}
+		if !static {
+			return file.Path, nil
+		}
+	}
+	return "", nil
+}
+
+// Checks whether the binary is statically linked (i.e., is an ELF file
+// without a dynamic loader).
+func isStatic(ctx context.Context, ref client.Reference, filename string) (bool, error) {
+	f, err := elf.NewFile(&fileReader{ctx: ctx, ref: ref, filename: filename})
+	if err != nil {
+		if _, ok := err.(*elf.FormatError); ok {
+			return false, nil
+		}
+		return false, err
+	}
+	for _, prog := range f.Progs {
+		if prog.Type == elf.PT_INTERP {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// Reads the parts of the file in the reference on demand.
+type fileReader struct {
+	ctx      context.Context
+	ref      client.Reference
+	filename string
+}
+
+// ReadAt reads len(p) bytes of the file starting at offset off.
+func (r *fileReader) ReadAt(p []byte, off int64) (int, error) {
+	data, err := r.ref.ReadFile(r.ctx, client.ReadRequest{
+		Filename: r.filename,
+		Range:    &client.FileRange{Offset: int(off), Length: len(p)},
+	})
+	if err != nil {
+		return 0, err
+	}
+	n := copy(p, data)
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
@@ -0,0 +1,246 @@
+package golang
+
+import (
+	"bytes"
+	"context"
+	"debug/elf"
+	"encoding/binary"
+	"testing"
+
+	cib_mock "github.com/EricHripko/buildkit-fdk/pkg/cib/mock"
+	"github.com/golang/mock/gomock"
+	"github.com/moby/buildkit/client/llb"
+	"github.com/moby/buildkit/frontend/dockerfile/dockerfile2llb"
+	"github.com/moby/buildkit/frontend/gateway/client"
+	specs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/require"
+	fsutil "github.com/tonistiigi/fsutil/types"
+)
+
+func TestRuntimeImage(t *testing.T) {
+	require.Equal(t, "gcr.io/distroless/static", runtimeImage(RTStatic, false))
+	require.Equal(t, "gcr.io/distroless/static:debug", runtimeImage(RTStatic, true))
+	require.Equal(t, "gcr.io/distroless/cc:debug", runtimeImage(RTCC, true))
+	require.Equal(t, "gcr.io/distroless/base:debug-nonroot", runtimeImage(RTNonRoot, true))
+	require.Equal(t, "alpine:3.13", runtimeImage("alpine:3.13", true))
+}
+
+// Creates a minimal ELF binary with or without the dynamic loader.
+func elfBinary(t *testing.T, dynamic bool) []byte {
+	var buf bytes.Buffer
+	header := elf.Header64{
+		Type:      uint16(elf.ET_EXEC),
+		Machine:   uint16(elf.EM_X86_64),
+		Version:   uint32(elf.EV_CURRENT),
+		Phoff:     64,
+		Ehsize:    64,
+		Phentsize: 56,
+		Phnum:     1,
+	}
+	copy(header.Ident[:], elf.ELFMAG)
+	header.Ident[elf.EI_CLASS] = byte(elf.ELFCLASS64)
+	header.Ident[elf.EI_DATA] = byte(elf.ELFDATA2LSB)
+	header.Ident[elf.EI_VERSION] = byte(elf.EV_CURRENT)
+	prog := elf.Prog64{Type: uint32(elf.PT_LOAD)}
+	if dynamic {
+		prog.Type = uint32(elf.PT_INTERP)
+	}
+	require.Nil(t, binary.Write(&buf, binary.LittleEndian, header))
+	require.Nil(t, binary.Write(&buf, binary.LittleEndian, prog))
+	return buf.Bytes()
+}
+
+// Sets up the build output with a single binary.
+func (suite *golangTestSuite) setupBinary(data []byte) {
+	suite.pluginConfig.Version = "1.14"
+	suite.detection.Config.Debug = false
+
+	suite.build.EXPECT().
+		From("golang:1.14", buildPlatform, gomock.Any()).
+		Return(llb.Scratch(), nil, nil)
+	suite.build.EXPECT().
+		SrcState().
+		Return(llb.Scratch(), nil)
+
+	ref := cib_mock.NewMockReference(suite.ctrl)
+	suite.build.EXPECT().
+		Solve(suite.ctx, gomock.Any()).
+		Return(ref, nil)
+	ref.EXPECT().
+		ReadDir(suite.ctx, client.ReadDirRequest{Path: dirInstall}).
+		Return([]*fsutil.Stat{{Path: "hello", Mode: 0755}}, nil)
+	ref.EXPECT().
+		ReadFile(suite.ctx, gomock.Any()).
+		DoAndReturn(func(_ context.Context, req client.ReadRequest) ([]byte, error) {
+			require.Equal(suite.T(), "/install/hello", req.Filename)
+			start := req.Range.Offset
+			if start > len(data) {
+				start = len(data)
+			}
+			end := start + req.Range.Length
+			if end > len(data) {
+				end = len(data)
+			}
+			return data[start:end], nil
+		}).
+		AnyTimes()
+}
+
+func (suite *golangTestSuite) TestBuildRuntimeStatic() {
+	// Arrange
+	platform := &specs.Platform{OS: "linux", Architecture: "amd64"}
+	suite.setupBinary(elfBinary(suite.T(), false))
+	suite.build.EXPECT().
+		From("gcr.io/distroless/static", platform, gomock.Any()).
+		Return(llb.Scratch(), &dockerfile2llb.Image{}, nil)
+
+	// Act
+	_, _, err := suite.plugin.Build(suite.ctx, platform, suite.build, suite.detection)
+
+	// Assert
+	require.Nil(suite.T(), err)
+}
+
+func (suite *golangTestSuite) TestBuildRuntimeMultiPlatform() {
+	platforms := []*specs.Platform{
+		{OS: "linux", Architecture: "amd64"},
+		{OS: "linux", Architecture: "arm64"},
+	}
+	for _, platform := range platforms {
+		// Arrange
+		suite.setupBinary(elfBinary(suite.T(), false))
+		suite.build.EXPECT().
+			From("gcr.io/distroless/static", platform, gomock.Any()).
+			Return(llb.Scratch(), &dockerfile2llb.Image{}, nil)
+
+		// Act
+		state, _, err := suite.plugin.Build(suite.ctx, platform, suite.build, suite.detection)
+
+		// Assert
+		require.Nil(suite.T(), err)
+		require.True(suite.T(), suite.contains(state, "CGO_ENABLED=0"), platform.Architecture)
+	}
+}
+
+func (suite *golangTestSuite) TestBuildRuntimeDynamic() {
+	// Arrange
+	platform := &specs.Platform{OS: "linux", Architecture: "amd64"}
+	suite.setupBinary(elfBinary(suite.T(), true))
+	suite.build.EXPECT().
+		From("gcr.io/distroless/base", platform, gomock.Any()).
+		Return(llb.Scratch(), &dockerfile2llb.Image{}, nil)
+
+	// Act
+	_, _, err := suite.plugin.Build(suite.ctx, platform, suite.build, suite.detection)
+
+	// Assert
+	require.Nil(suite.T(), err)
+}
+
+func (suite *golangTestSuite) TestBuildRuntimeNotELF() {
+	// Arrange
+	platform := &specs.Platform{OS: "linux", Architecture: "amd64"}
+	suite.setupBinary([]byte("#!/bin/sh\necho hello\n"))
+	suite.build.EXPECT().
+		From("gcr.io/distroless/base", platform, gomock.Any()).
+		Return(llb.Scratch(), &dockerfile2llb.Image{}, nil)
+
+	// Act
+	_, _, err := suite.plugin.Build(suite.ctx, platform, suite.build, suite.detection)
+
+	// Assert
+	require.Nil(suite.T(), err)
+}
+
+func (suite *golangTestSuite) TestBuildRuntimeScratch() {
+	// Arrange
+	suite.pluginConfig.Runtime = RTScratch
+	platform := &specs.Platform{OS: "linux", Architecture: "arm64", Variant: "v8"}
+	suite.setupBinary(elfBinary(suite.T(), false))
+
+	// Act
+	state, img, err := suite.plugin.Build(suite.ctx, platform, suite.build, suite.detection)
+
+	// Assert
+	require.Nil(suite.T(), err)
+	require.NotNil(suite.T(), state)
+	require.Equal(suite.T(), "arm64", img.Architecture)
+	require.Equal(suite.T(), "v8", img.Variant)
+	require.Contains(suite.T(), img.Config.Env[0], "PATH=")
+	require.Equal(suite.T(), "65534", img.Config.User)
+}
+
+func (suite *golangTestSuite) TestBuildRuntimeScratchDynamic() {
+	// Arrange
+	suite.pluginConfig.Runtime = RTScratch
+	platform := &specs.Platform{OS: "linux", Architecture: "amd64"}
+	suite.setupBinary(elfBinary(suite.T(), true))
+
+	// Act
+	_, _, err := suite.plugin.Build(suite.ctx, platform, suite.build, suite.detection)
+
+	// Assert
+	require.NotNil(suite.T(), err)
+	require.Contains(suite.T(), err.Error(), "hello is not statically linked and cannot run in scratch runtime")
+}
+
+func (suite *golangTestSuite) TestBuildStatic() {
+	// Arrange
+	cgo := true
+	suite.pluginConfig.CGO = &cgo
+	suite.pluginConfig.Static = true
+	suite.pluginConfig.Tags = []string{"wireinject"}
+	platform := &specs.Platform{OS: "linux", Architecture: "amd64"}
+	suite.setupBinary(elfBinary(suite.T(), false))
+	suite.build.EXPECT().
+		From("gcr.io/distroless/static", platform, gomock.Any()).
+		Return(llb.Scratch(), &dockerfile2llb.Image{}, nil)
+
+	// Act
+	state, _, err := suite.plugin.Build(suite.ctx, platform, suite.build, suite.detection)
+
+	// Assert
+	require.Nil(suite.T(), err)
+	require.True(suite.T(), suite.contains(state, "CGO_ENABLED=1"))
+	require.True(suite.T(), suite.contains(state, "-extldflags -static"))
+	require.True(suite.T(), suite.contains(state, "wireinject,netgo,osusergo"))
+	require.Equal(suite.T(), []string{"wireinject"}, suite.pluginConfig.Tags)
+}
+
+func (suite *golangTestSuite) TestBuildStaticDynamic() {
+	// Arrange
+	suite.pluginConfig.Static = true
+	suite.pluginConfig.Runtime = RTBase
+	platform := &specs.Platform{OS: "linux", Architecture: "amd64"}
+	suite.setupBinary(elfBinary(suite.T(), true))
+
+	// Act
+	_, _, err := suite.plugin.Build(suite.ctx, platform, suite.build, suite.detection)
+
+	// Assert
+	require.NotNil(suite.T(), err)
+	require.Contains(suite.T(), err.Error(), "golang: hello is not statically linked")
+}
+
+func (suite *golangTestSuite) TestBuildRuntimeCustom() {
+	// Arrange
+	suite.pluginConfig.Version = "1.14"
+	suite.pluginConfig.Runtime = "alpine:3.13"
+
+	platform := &specs.Platform{OS: "linux", Architecture: "amd64"}
+	suite.build.EXPECT().
+		From("golang:1.14", platform, gomock.Any()).
+		Return(llb.Scratch(), nil, nil)
+	suite.build.EXPECT().
+		SrcState().
+		Return(llb.Scratch(), nil)
+	suite.build.EXPECT().
+		From("alpine:3.13", platform, gomock.Any()).
+		Return(llb.Scratch(), &dockerfile2llb.Image{}, nil)
+
+	// Act
+	_, _, err := suite.plugin.Build(suite.ctx, platform, suite.build, suite.detection)
+
+	// Assert
+	require.Nil(suite.T(), err)
+}
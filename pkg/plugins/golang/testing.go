@@ -0,0 +1,147 @@
+package golang
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/EricHripko/pack.yaml/pkg/packer2llb"
+
+	"github.com/EricHripko/buildkit-fdk/pkg/cib"
+	"github.com/moby/buildkit/client/llb"
+	specs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+// ReportFormat describes all the supported formats for test reports.
+type ReportFormat string
+
+// Values returns the report formats that can be configured.
+func (ReportFormat) Values() []string {
+	return []string{RFJSON, RFJUnit}
+}
+
+const (
+	// RFJSON represents the output of go test -json.
+	RFJSON = "json"
+	// RFJUnit represents a JUnit XML report.
+	RFJUnit = "junit"
+)
+
+// ErrUnknownReport is returned when an unsupported test report format is
+// configured.
+var ErrUnknownReport = errors.New("golang: unknown test report format")
+
+// TestConfig for running the tests of the project.
+type TestConfig struct {
+	// Format of the test report (no report is produced if omitted).
+	Report ReportFormat
+}
+
+const (
+	// Directory where test reports are written.
+	dirReports = "/reports"
+	// Directory where the tools for tests are installed.
+	dirTools = "/tools"
+	// Tool that converts go test output into a JUnit XML report.
+	toolJUnit = "github.com/jstemmer/go-junit-report@v0.9.1"
+)
+
+// Test runs the tests of this Go project.
+func (p *Plugin) Test(ctx context.Context, platform *specs.Platform, build cib.Service, detection *packer2llb.Detection) (*llb.State, error) {
+	// Tests are executed, so they aren't cross-compiled
+	state, run, pluginConfig, err := p.prepare(platform, build, detection, false)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create report directory
+	state = state.File(
+		llb.Mkdir(dirReports, 0755),
+		llb.WithCustomName("Create test report directory"),
+	)
+	// Test
+	test := append([]string{"go", "test"}, tagsFlag(pluginConfig.Tags)...)
+	test = append(test, modFlag(pluginConfig)...)
+	packages := []string{allPackages}
+	if len(pluginConfig.modules) > 0 {
+		packages = workPatterns(pluginConfig.modules)
+	}
+	switch pluginConfig.Test.Report {
+	case "":
+		test = append(test, "-v")
+		run = append(run, llb.Args(append(test, packages...)))
+	case RFJSON:
+		test = append(append(test, "-json"), packages...)
+		run = append(run, llb.Args([]string{"/bin/sh", "-c", fmt.Sprintf(
+			"%s > %s/report.json; status=$?; cat %s/report.json; exit $status",
+			strings.Join(test, " "), dirReports, dirReports,
+		)}))
+	case RFJUnit:
+		tools, err := p.tools(platform, build, pluginConfig)
+		if err != nil {
+			return nil, err
+		}
+		test = append(append(test, "-v"), packages...)
+		run = append(run,
+			llb.AddMount(dirTools, tools, llb.Readonly),
+			llb.Args([]string{"/bin/sh", "-c", fmt.Sprintf(
+				"%s > /tmp/test.log 2>&1; status=$?; cat /tmp/test.log; %s/go-junit-report < /tmp/test.log > %s/report.xml; exit $status",
+				strings.Join(test, " "), dirTools, dirReports,
+			)}),
+		)
+	default:
+		return nil, ErrUnknownReport
+	}
+	run = append(run, llb.WithCustomNamef("Test %s", detection.Project))
+	testState := state.Dir(srcDir(pluginConfig)).Run(run...).Root()
+
+	// Export reports
+	reports := llb.Scratch().File(
+		llb.Copy(
+			testState,
+			dirReports,
+			"/",
+			&llb.CopyInfo{CopyDirContentsOnly: true},
+		),
+		llb.WithCustomName("Export test report(s)"),
+	)
+	return &reports, nil
+}
+
+// Builds the tools required for producing the test reports. The tools are
+// built with the same image and settings as the project (e.g., the module
+// proxy) on the build platform and cross-compiled for the target platform.
+func (p *Plugin) tools(platform *specs.Platform, build cib.Service, pluginConfig *Config) (llb.State, error) {
+	base := buildImage(pluginConfig)
+	state, _, err := build.From(
+		base,
+		build.GetBuildPlatform(),
+		fmt.Sprintf("Base tools image is %s", base),
+	)
+	if err != nil {
+		return llb.State{}, err
+	}
+
+	run := goEnv(pluginConfig, build.GetBuildArgs())
+	run = append(run, privateOpts(pluginConfig)...)
+	if platform != nil {
+		run = append(run, targetEnv(platform)...)
+	}
+	// Before Go 1.16, go install doesn't accept versions
+	install := "go install " + toolJUnit
+	if minor := minorVersion(pluginConfig.Version); minor >= 0 && minor < 16 {
+		install = "GO111MODULE=on go get " + toolJUnit
+	}
+	// Cross-compiled tools are installed into a subdirectory of GOPATH/bin
+	// (e.g., linux_arm64), since go install doesn't allow GOBIN for them
+	run = append(run,
+		llb.AddEnv("CGO_ENABLED", "0"),
+		llb.Args([]string{"/bin/sh", "-c", fmt.Sprintf(
+			"%s && find \"$(go env GOPATH)/bin\" -type f -exec cp {} %s/ \\;",
+			install, dirTools,
+		)}),
+		llb.WithCustomName("Install test report tools"),
+	)
+	return state.Run(run...).AddMount(dirTools, llb.Scratch()), nil
+}
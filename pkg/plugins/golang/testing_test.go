@@ -0,0 +1,162 @@
+package golang
+
+import (
+	"bytes"
+	"errors"
+
+	"github.com/golang/mock/gomock"
+	"github.com/moby/buildkit/client/llb"
+	specs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/require"
+)
+
+// Returns whether the definition of the state mentions the value.
+func (suite *golangTestSuite) contains(state *llb.State, value string) bool {
+	def, err := state.Marshal(suite.ctx)
+	require.Nil(suite.T(), err)
+	for _, op := range def.Def {
+		if bytes.Contains(op, []byte(value)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (suite *golangTestSuite) TestTestFailsFrom() {
+	// Arrange
+	suite.pluginConfig.Version = "1.14"
+
+	platform := &specs.Platform{OS: "linux", Architecture: "amd64"}
+	expected := errors.New("something went wrong")
+	suite.build.EXPECT().
+		From("golang:1.14", platform, gomock.Any()).
+		Return(llb.Scratch(), nil, expected)
+
+	// Act
+	_, actual := suite.plugin.Test(suite.ctx, platform, suite.build, suite.detection)
+
+	// Assert
+	require.Same(suite.T(), expected, actual)
+}
+
+func (suite *golangTestSuite) TestTestUnknownReport() {
+	// Arrange
+	suite.pluginConfig.Version = "1.14"
+	suite.pluginConfig.Test.Report = "xml"
+
+	platform := &specs.Platform{OS: "linux", Architecture: "amd64"}
+	suite.build.EXPECT().
+		From("golang:1.14", platform, gomock.Any()).
+		Return(llb.Scratch(), nil, nil)
+	suite.build.EXPECT().
+		SrcState().
+		Return(llb.Scratch(), nil)
+
+	// Act
+	_, err := suite.plugin.Test(suite.ctx, platform, suite.build, suite.detection)
+
+	// Assert
+	require.Same(suite.T(), ErrUnknownReport, err)
+}
+
+func (suite *golangTestSuite) TestTestSucceeds() {
+	// Arrange
+	suite.pluginConfig.DependencyMode = DMGoMod
+	suite.pluginConfig.Version = "1.14"
+	suite.pluginConfig.Tags = []string{"integration"}
+
+	platform := &specs.Platform{OS: "linux", Architecture: "amd64"}
+	suite.build.EXPECT().
+		From("golang:1.14", platform, gomock.Any()).
+		Return(llb.Scratch(), nil, nil)
+	suite.build.EXPECT().
+		SrcState().
+		Return(llb.Scratch(), nil)
+
+	// Act
+	state, err := suite.plugin.Test(suite.ctx, platform, suite.build, suite.detection)
+
+	// Assert
+	require.Nil(suite.T(), err)
+	require.True(suite.T(), suite.contains(state, "integration"))
+	require.True(suite.T(), suite.contains(state, dirModFiles))
+	require.False(suite.T(), suite.contains(state, "report.json"))
+	require.False(suite.T(), suite.contains(state, "report.xml"))
+}
+
+func (suite *golangTestSuite) TestTestJSONReport() {
+	// Arrange
+	suite.pluginConfig.Version = "1.14"
+	suite.pluginConfig.Test.Report = RFJSON
+
+	platform := &specs.Platform{OS: "linux", Architecture: "amd64"}
+	suite.build.EXPECT().
+		From("golang:1.14", platform, gomock.Any()).
+		Return(llb.Scratch(), nil, nil)
+	suite.build.EXPECT().
+		SrcState().
+		Return(llb.Scratch(), nil)
+
+	// Act
+	state, err := suite.plugin.Test(suite.ctx, platform, suite.build, suite.detection)
+
+	// Assert
+	require.Nil(suite.T(), err)
+	require.True(suite.T(), suite.contains(state, "go test -json ./..."))
+	require.True(suite.T(), suite.contains(state, "/reports/report.json"))
+}
+
+func (suite *golangTestSuite) TestTestWorkspace() {
+	// Arrange
+	suite.pluginConfig.DependencyMode = DMWorkspace
+	suite.pluginConfig.Version = "1.18"
+	suite.pluginConfig.Test.Report = RFJSON
+	suite.pluginConfig.modules = []workModule{
+		{Dir: ".", Path: "github.com/notareal/project"},
+		{Dir: "worker", Path: "github.com/notareal/worker"},
+	}
+
+	platform := &specs.Platform{OS: "linux", Architecture: "amd64"}
+	suite.build.EXPECT().
+		From("golang:1.18", platform, gomock.Any()).
+		Return(llb.Scratch(), nil, nil)
+	suite.build.EXPECT().
+		SrcState().
+		Return(llb.Scratch(), nil)
+
+	// Act
+	state, err := suite.plugin.Test(suite.ctx, platform, suite.build, suite.detection)
+
+	// Assert
+	require.Nil(suite.T(), err)
+	require.True(suite.T(), suite.contains(state, "go test -json ./... ./worker/..."))
+	require.True(suite.T(), suite.contains(state, dirModFiles))
+}
+
+func (suite *golangTestSuite) TestTestJUnitReport() {
+	// Arrange
+	suite.pluginConfig.Version = "1.14"
+	suite.pluginConfig.Test.Report = RFJUnit
+	suite.pluginConfig.Proxy = "https://proxy.example.com"
+
+	platform := &specs.Platform{OS: "linux", Architecture: "arm64"}
+	suite.build.EXPECT().
+		From("golang:1.14", platform, gomock.Any()).
+		Return(llb.Scratch(), nil, nil)
+	suite.build.EXPECT().
+		SrcState().
+		Return(llb.Scratch(), nil)
+	suite.build.EXPECT().
+		From("golang:1.14", buildPlatform, gomock.Any()).
+		Return(llb.Scratch(), nil, nil)
+
+	// Act
+	state, err := suite.plugin.Test(suite.ctx, platform, suite.build, suite.detection)
+
+	// Assert
+	require.Nil(suite.T(), err)
+	require.True(suite.T(), suite.contains(state, "GO111MODULE=on go get "+toolJUnit))
+	require.True(suite.T(), suite.contains(state, "GOARCH=arm64"))
+	require.True(suite.T(), suite.contains(state, "GOPROXY=https://proxy.example.com"))
+	require.True(suite.T(), suite.contains(state, "/reports/report.xml"))
+}
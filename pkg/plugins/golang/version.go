@@ -0,0 +1,95 @@
+package golang
+
+import (
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+)
+
+// Repository of the official Go images.
+const imageGolang = "golang"
+
+// Regular expression for the first release of a Go version (e.g., 1.20.0).
+// Before Go 1.21 these were published without the patch (e.g., golang:1.20).
+var firstReleaseRegex = regexp.MustCompile(`^1\.([0-9]+)\.0$`)
+
+// Regular expression for the minor version of a Go version (e.g., 16 in
+// 1.16.3 or 1.16rc1).
+var minorRegex = regexp.MustCompile(`^1\.([0-9]+)`)
+
+// Returns the version of Go that the module (or workspace) is built with:
+// the toolchain directive if present, the go directive otherwise.
+func moduleVersion(goDirective *modfile.Go, syntax *modfile.FileSyntax) string {
+	if version := toolchainVersion(syntax); version != "" {
+		return version
+	}
+	if goDirective == nil {
+		return ""
+	}
+	return goDirective.Version
+}
+
+// Returns the version from the toolchain directive (e.g., 1.22.3 for
+// toolchain go1.22.3). The go.mod file must be parsed with
+// modfile.ParseLax, which only keeps the directive in the syntax.
+func toolchainVersion(syntax *modfile.FileSyntax) string {
+	for _, stmt := range syntax.Stmt {
+		line, ok := stmt.(*modfile.Line)
+		if !ok || len(line.Token) != 2 || line.Token[0] != "toolchain" {
+			continue
+		}
+		name := line.Token[1]
+		if !strings.HasPrefix(name, "go1") {
+			// Not a release (e.g., default)
+			return ""
+		}
+		// Drop the custom suffix (e.g., go1.21.0+auto or go1.21.0-corp)
+		version := strings.TrimPrefix(name, "go")
+		if i := strings.IndexAny(version, "+-"); i >= 0 {
+			version = version[:i]
+		}
+		return version
+	}
+	return ""
+}
+
+// Returns the minor version of Go (e.g., 16 for 1.16.3), -1 if the version
+// isn't recognised.
+func minorVersion(version string) int {
+	match := minorRegex.FindStringSubmatch(version)
+	if match == nil {
+		return -1
+	}
+	minor, err := strconv.Atoi(match[1])
+	if err != nil {
+		return -1
+	}
+	return minor
+}
+
+// Returns the tag of the golang image for the version of Go.
+func imageTag(version string) string {
+	if match := firstReleaseRegex.FindStringSubmatch(version); match != nil {
+		if minor, err := strconv.Atoi(match[1]); err == nil && minor < 21 {
+			return strings.TrimSuffix(version, ".0")
+		}
+	}
+	return version
+}
+
+// Returns the image that the project is built in. The custom image (e.g.,
+// a registry mirror) is tagged with the version of Go unless it's already
+// tagged or pinned by digest.
+func buildImage(pluginConfig *Config) string {
+	image := pluginConfig.Image
+	if image == "" {
+		image = imageGolang
+	}
+	if name := path.Base(image); strings.ContainsAny(name, ":@") {
+		return image
+	}
+	return image + ":" + imageTag(pluginConfig.Version)
+}
@@ -0,0 +1,99 @@
+package golang
+
+import (
+	"testing"
+
+	"github.com/EricHripko/pack.yaml/pkg/packer2llb/config"
+
+	"github.com/golang/mock/gomock"
+	"github.com/moby/buildkit/client/llb"
+	specs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/mod/modfile"
+)
+
+func TestModuleVersion(t *testing.T) {
+	tests := map[string]string{
+		"go 1.15\n":                          "1.15",
+		"go 1.21.0\n":                        "1.21.0",
+		"go 1.21.0\ntoolchain go1.22.3\n":    "1.22.3",
+		"go 1.21.0\ntoolchain default\n":     "1.21.0",
+		"go 1.21\ntoolchain go1.21.4+auto\n": "1.21.4",
+	}
+	for data, expected := range tests {
+		// Arrange
+		goMod, err := modfile.ParseLax("go.mod", []byte("module example.com/app\n"+data), nil)
+		require.Nil(t, err)
+
+		// Act
+		actual := moduleVersion(goMod.Go, goMod.Syntax)
+
+		// Assert
+		require.Equal(t, expected, actual, data)
+	}
+}
+
+func TestImageTag(t *testing.T) {
+	require.Equal(t, "1.14", imageTag("1.14"))
+	require.Equal(t, "1.20", imageTag("1.20.0"))
+	require.Equal(t, "1.20.3", imageTag("1.20.3"))
+	require.Equal(t, "1.21.0", imageTag("1.21.0"))
+	require.Equal(t, "1.22rc1", imageTag("1.22rc1"))
+}
+
+func TestMinorVersion(t *testing.T) {
+	require.Equal(t, 14, minorVersion("1.14"))
+	require.Equal(t, 16, minorVersion("1.16.3"))
+	require.Equal(t, 22, minorVersion("1.22rc1"))
+	require.Equal(t, -1, minorVersion(""))
+}
+
+func TestBuildImage(t *testing.T) {
+	require.Equal(t, "golang:1.20", buildImage(&Config{Version: "1.20.0"}))
+	require.Equal(
+		t,
+		"mirror.example.com:5000/library/golang:1.22.3",
+		buildImage(&Config{Version: "1.22.3", Image: "mirror.example.com:5000/library/golang"}),
+	)
+	require.Equal(
+		t,
+		"golang:1.22.3@sha256:0123",
+		buildImage(&Config{Version: "1.21", Image: "golang:1.22.3@sha256:0123"}),
+	)
+}
+
+func (suite *golangTestSuite) TestDetectToolchain() {
+	// Arrange
+	suite.setupProject(map[string]string{
+		"go.mod":  "module github.com/notareal/project\n\ngo 1.21.0\n\ntoolchain go1.22.3\n",
+		"go.sum":  "",
+		"main.go": "package main",
+	})
+
+	// Act
+	detection, err := suite.plugin.Detect(suite.ctx, suite.src, config.New())
+
+	// Assert
+	require.Nil(suite.T(), err)
+	require.Equal(suite.T(), "1.22.3", detection.Version)
+}
+
+func (suite *golangTestSuite) TestBuildArtifactsImage() {
+	// Arrange
+	suite.pluginConfig.Version = "1.20.0"
+	suite.pluginConfig.Image = "mirror.example.com/golang"
+
+	platform := &specs.Platform{OS: "linux", Architecture: "amd64"}
+	suite.build.EXPECT().
+		From("mirror.example.com/golang:1.20", platform, gomock.Any()).
+		Return(llb.Scratch(), nil, nil)
+	suite.build.EXPECT().
+		SrcState().
+		Return(llb.Scratch(), nil)
+
+	// Act
+	_, err := suite.plugin.BuildArtifacts(suite.ctx, platform, suite.build, suite.detection)
+
+	// Assert
+	require.Nil(suite.T(), err)
+}
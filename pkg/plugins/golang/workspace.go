@@ -0,0 +1,128 @@
+package golang
+
+import (
+	"context"
+	"path"
+	"strings"
+
+	"github.com/moby/buildkit/frontend/gateway/client"
+	"github.com/pkg/errors"
+	"golang.org/x/mod/modfile"
+)
+
+// Module used by a Go workspace.
+type workModule struct {
+	// Directory of the module relative to the root (e.g., services/api).
+	Dir string
+	// Path of the module (e.g., github.com/example/api).
+	Path string
+}
+
+// Go workspace described by a go.work file.
+type workspace struct {
+	// Version of Go declared by the workspace.
+	Version string
+	// Modules used by the workspace.
+	Modules []workModule
+	// Directories with the module files that are needed to resolve the
+	// dependencies (the modules along with their local replacements).
+	Dirs []string
+}
+
+// Reads the go.work file along with the go.mod files of the modules that it
+// uses.
+func readWorkspace(ctx context.Context, src client.Reference) (*workspace, error) {
+	data, err := src.ReadFile(ctx, client.ReadRequest{Filename: "go.work"})
+	if err != nil {
+		return nil, errors.Wrap(err, "fail to read go.work")
+	}
+	goWork, err := modfile.ParseWork("go.work", data, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "fail to parse go.work")
+	}
+	if goWork.Go == nil || len(goWork.Use) == 0 {
+		return nil, ErrWorkIncomplete
+	}
+
+	work := &workspace{
+		Version: moduleVersion(goWork.Go, goWork.Syntax),
+		Modules: make([]workModule, 0, len(goWork.Use)),
+	}
+	var replaces []string
+	for _, use := range goWork.Use {
+		dir := path.Clean(use.Path)
+		if path.IsAbs(dir) || dir == ".." || strings.HasPrefix(dir, "../") {
+			return nil, errors.Errorf("golang: module %s is outside of the build context", use.Path)
+		}
+		filename := path.Join(dir, "go.mod")
+		data, err := src.ReadFile(ctx, client.ReadRequest{Filename: filename})
+		if err != nil {
+			return nil, errors.Wrapf(err, "fail to read %s", filename)
+		}
+		goMod, err := modfile.ParseLax(filename, data, nil)
+		if err != nil {
+			return nil, errors.Wrapf(err, "fail to parse %s", filename)
+		}
+		if goMod.Module == nil {
+			return nil, ErrModIncomplete
+		}
+		work.Modules = append(work.Modules, workModule{Dir: dir, Path: goMod.Module.Mod.Path})
+		work.Dirs = append(work.Dirs, dir)
+		replaces = append(replaces, localReplaces(dir, goMod.Syntax)...)
+	}
+	replaces = append(replaces, localReplaces(".", goWork.Syntax)...)
+	work.Dirs = appendUnique(work.Dirs, replaces...)
+	return work, nil
+}
+
+// Appends the values that aren't in the list yet.
+func appendUnique(list []string, values ...string) []string {
+	for _, value := range values {
+		found := false
+		for _, existing := range list {
+			if existing == value {
+				found = true
+				break
+			}
+		}
+		if !found {
+			list = append(list, value)
+		}
+	}
+	return list
+}
+
+// Returns the workspace module that contains the directory (nil if none of
+// the modules do). Nested modules take precedence over their parents.
+func findModule(modules []workModule, dir string) *workModule {
+	var found *workModule
+	for i, module := range modules {
+		if module.Dir != "." && dir != module.Dir && !strings.HasPrefix(dir, module.Dir+"/") {
+			continue
+		}
+		if found == nil || len(module.Dir) > len(found.Dir) {
+			found = &modules[i]
+		}
+	}
+	return found
+}
+
+// Returns the directory relative to the root of the module.
+func (m *workModule) rel(dir string) string {
+	if m.Dir == "." {
+		return dir
+	}
+	if dir == m.Dir {
+		return "."
+	}
+	return strings.TrimPrefix(dir, m.Dir+"/")
+}
+
+// Returns the patterns that match all the packages of the workspace.
+func workPatterns(modules []workModule) []string {
+	patterns := make([]string, 0, len(modules))
+	for _, module := range modules {
+		patterns = append(patterns, "./"+path.Join(module.Dir, allPackages))
+	}
+	return patterns
+}